@@ -0,0 +1,106 @@
+package clccam
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/semver"
+)
+
+/*
+ * Agent Health
+ *
+ * Each machine of an instance service runs an agent, which periodically pings CAM.
+ */
+
+// AgentCheck specifies the criteria used to flag unhealthy agents.
+type AgentCheck struct {
+	// Maximum time since the last agent ping (0 disables the check).
+	MaxPingAge time.Duration
+
+	// Minimum agent version (nil disables the check).
+	MinVersion *semver.Version
+}
+
+// AgentStatus describes the agent of a single machine.
+type AgentStatus struct {
+	Instance      string        `json:"instance"`       // Instance ID
+	InstanceName  string        `json:"instance_name"`  // Instance name
+	InstanceState InstanceState `json:"instance_state"` // State of the instance
+	Owner         string        `json:"owner"`          // Instance owner
+	Machine       string        `json:"machine"`        // Machine name
+	Hostname      string        `json:"hostname"`       // Machine hostname, if set
+	State         InstanceState `json:"state"`          // State of the machine
+	AgentVersion  string        `json:"agent_version"`  // e.g. "6.11", empty if not reported
+	LastPing      time.Time     `json:"last_ping"`      // Time of last agent ping, zero if never
+	PingAge       time.Duration `json:"ping_age"`       // Time since last ping, 0 if never
+	Problems      []string      `json:"problems"`       // Problems found, empty if healthy
+}
+
+// Healthy returns true if no problems were found for @a.
+func (a AgentStatus) Healthy() bool {
+	return len(a.Problems) == 0
+}
+
+// CheckAgents evaluates the agents of all machines of @srv, belonging to @inst, against @check.
+func CheckAgents(inst *Instance, srv *InstanceService, check AgentCheck, now time.Time) (res []AgentStatus) {
+	for _, m := range srv.Machines {
+		var a = AgentStatus{
+			Instance:      inst.ID,
+			InstanceName:  inst.Name,
+			InstanceState: inst.State,
+			Owner:         inst.Owner,
+			Machine:       m.Name,
+			Hostname:      m.Hostname,
+			State:         m.State,
+			AgentVersion:  m.AgentVersion.Original(),
+			LastPing:      m.LastAgentPing.Time,
+		}
+
+		if a.LastPing.IsZero() {
+			a.Problems = append(a.Problems, "agent never pinged")
+		} else if a.PingAge = now.Sub(a.LastPing); check.MaxPingAge > 0 && a.PingAge > check.MaxPingAge {
+			a.Problems = append(a.Problems, fmt.Sprintf("no ping for %s", a.PingAge.Round(time.Second)))
+		}
+
+		if check.MinVersion != nil {
+			if a.AgentVersion == "" {
+				a.Problems = append(a.Problems, "agent version unknown")
+			} else if m.AgentVersion.LessThan(check.MinVersion) {
+				a.Problems = append(a.Problems, fmt.Sprintf("agent %s older than %s", a.AgentVersion, check.MinVersion.Original()))
+			}
+		}
+
+		if m.State != inst.State {
+			a.Problems = append(a.Problems, fmt.Sprintf("machine %s, instance %s", m.State, inst.State))
+		}
+		res = append(res, a)
+	}
+	return res
+}
+
+// ScanAgents checks the agents of all machines of @instances, fetching services with up to @parallel requests.
+// Instances that are terminated or powered off are skipped. Returns the errors encountered, indexed by instance ID.
+func (c *Client) ScanAgents(instances []Instance, check AgentCheck, parallel int) ([]AgentStatus, map[string]error) {
+	var (
+		res  []AgentStatus
+		ids  []string
+		byId = make(map[string]*Instance)
+		now  = time.Now()
+	)
+
+	for i := range instances {
+		if instances[i].PoweredOn() {
+			ids = append(ids, instances[i].ID)
+			byId[instances[i].ID] = &instances[i]
+		}
+	}
+
+	services, errs := c.GetInstanceServices(ids, parallel)
+	for _, id := range ids {
+		if srv, ok := services[id]; ok {
+			res = append(res, CheckAgents(byId[id], &srv, check, now)...)
+		}
+	}
+	return res, errs
+}
@@ -0,0 +1,263 @@
+package clccam
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+/*
+ * Compliance Audit
+ *
+ * Scans instances and boxes for policy violations.
+ */
+
+// AuditRule identifies the policy that an AuditFinding violates.
+type AuditRule string
+
+const (
+	AuditPublicAddress      AuditRule = "public-address"      // machine has a public IP address
+	AuditAutomaticUpdates   AuditRule = "automatic-updates"   // automatic updates are off
+	AuditUnmanagedOS        AuditRule = "unmanaged-os"        // OS is not managed
+	AuditElasticIP          AuditRule = "elastic-ip"          // profile requests an elastic IP
+	AuditPublicPersonalBox  AuditRule = "public-personal-box" // public box owned by an individual
+	AuditDefaultPassword    AuditRule = "default-password"    // Password variable with a default value
+	AuditOutdatedBoxVersion AuditRule = "outdated-box"        // instance deployed from an outdated box version
+)
+
+// AuditSeverity ranks findings.
+type AuditSeverity string
+
+const (
+	AuditHigh   AuditSeverity = "high"
+	AuditMedium AuditSeverity = "medium"
+	AuditLow    AuditSeverity = "low"
+)
+
+// auditSeverities assigns a severity to each rule.
+var auditSeverities = map[AuditRule]AuditSeverity{
+	AuditPublicAddress:      AuditHigh,
+	AuditDefaultPassword:    AuditHigh,
+	AuditPublicPersonalBox:  AuditMedium,
+	AuditElasticIP:          AuditMedium,
+	AuditUnmanagedOS:        AuditMedium,
+	AuditAutomaticUpdates:   AuditLow,
+	AuditOutdatedBoxVersion: AuditLow,
+}
+
+// AuditFinding is a single policy violation.
+type AuditFinding struct {
+	Rule     AuditRule     `json:"rule"`
+	Severity AuditSeverity `json:"severity"`
+	Kind     string        `json:"kind"`  // "instance" or "box"
+	ID       string        `json:"id"`    // instance or box ID
+	Name     string        `json:"name"`  // instance or box name
+	Owner    string        `json:"owner"` // instance or box owner
+	Detail   string        `json:"detail"`
+}
+
+// AuditReport is the result of an audit.
+type AuditReport struct {
+	// Time the audit was performed
+	Generated time.Time `json:"generated"`
+
+	// Number of instances and boxes scanned
+	Instances int `json:"instances"`
+	Boxes     int `json:"boxes"`
+
+	// Violations found, most severe first
+	Findings []AuditFinding `json:"findings"`
+
+	// Problems encountered during the scan (the report may be incomplete)
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Counts returns the number of findings per rule.
+func (r *AuditReport) Counts() map[AuditRule]int {
+	var res = make(map[AuditRule]int)
+
+	for _, f := range r.Findings {
+		res[f.Rule]++
+	}
+	return res
+}
+
+// add appends a finding for @rule to @r.
+func (r *AuditReport) add(rule AuditRule, kind, id, name, owner, format string, a ...interface{}) {
+	r.Findings = append(r.Findings, AuditFinding{
+		Rule:     rule,
+		Severity: auditSeverities[rule],
+		Kind:     kind,
+		ID:       id,
+		Name:     name,
+		Owner:    owner,
+		Detail:   fmt.Sprintf(format, a...),
+	})
+}
+
+// Audit scans all accessible instances and boxes, using up to @parallel concurrent requests
+// for per-instance queries. It only fails if neither instances nor boxes can be listed.
+func (c *Client) Audit(parallel int) (*AuditReport, error) {
+	var report = &AuditReport{Generated: time.Now()}
+
+	instances, ierr := c.GetInstances()
+	if ierr != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to query instances: %s", ierr))
+	}
+	boxes, berr := c.GetBoxes()
+	if berr != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to query boxes: %s", berr))
+	}
+	if ierr != nil && berr != nil {
+		return nil, ierr
+	}
+
+	c.auditInstances(report, instances, parallel)
+	c.auditBoxes(report, boxes)
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		var a, b = report.Findings[i], report.Findings[j]
+
+		if a.Severity != b.Severity {
+			return auditRank(a.Severity) < auditRank(b.Severity)
+		} else if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.ID < b.ID
+	})
+	return report, nil
+}
+
+// auditRank orders severities, most severe first.
+func auditRank(s AuditSeverity) int {
+	switch s {
+	case AuditHigh:
+		return 0
+	case AuditMedium:
+		return 1
+	}
+	return 2
+}
+
+// auditInstances adds the findings of non-terminated @instances to @report.
+func (c *Client) auditInstances(report *AuditReport, instances []Instance, parallel int) {
+	var (
+		ids      []string
+		versions = make(map[string][]Box) // box versions, indexed by parent box ID
+	)
+
+	for i := range instances {
+		var inst = &instances[i]
+
+		if inst.IsTerminated() {
+			continue
+		}
+		report.Instances++
+		ids = append(ids, inst.ID)
+
+		if inst.AutomaticUpdates == "off" {
+			report.add(AuditAutomaticUpdates, "instance", inst.ID, inst.Name, inst.Owner, "automatic updates are off")
+		}
+
+		// Boxes deployed from a version, compared against the latest version of their box.
+		for j := range inst.Boxes {
+			var b = &inst.Boxes[j]
+
+			if b.BoxVersion == nil || b.BoxVersion.IsZero() {
+				continue
+			}
+			var parent = b.BoxVersion.Box.String()
+
+			if _, ok := versions[parent]; !ok {
+				res, err := c.GetBoxVersions(parent)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("failed to query versions of box %s: %s", parent, err))
+				}
+				versions[parent] = res
+			}
+
+			if latest, ok := LatestBoxVersion(versions[parent]); ok && b.Version().LessThan(latest) {
+				report.add(AuditOutdatedBoxVersion, "instance", inst.ID, inst.Name, inst.Owner,
+					"box %s is at version %s, latest is %s", b.Name, b.Version(), latest)
+			}
+		}
+	}
+
+	services, errs := c.GetInstanceServices(ids, parallel)
+	for id, err := range errs {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to query service of %s: %s", id, err))
+	}
+	sort.Strings(report.Errors)
+
+	for i := range instances {
+		var inst = &instances[i]
+
+		srv, ok := services[inst.ID]
+		if !ok {
+			continue
+		}
+		for _, m := range srv.Machines {
+			if m.Address.Public != nil && *m.Address.Public != "" {
+				report.add(AuditPublicAddress, "instance", inst.ID, inst.Name, inst.Owner,
+					"machine %s has public address %s", m.Name, *m.Address.Public)
+			}
+		}
+		if srv.Profile.ElasticIP {
+			report.add(AuditElasticIP, "instance", inst.ID, inst.Name, inst.Owner, "profile uses an elastic IP")
+		}
+		// Services without a deployment profile (e.g. CloudFormation) have no OS to manage.
+		if !srv.Profile.ManagedOs && !srv.Profile.Schema.IsZero() {
+			report.add(AuditUnmanagedOS, "instance", inst.ID, inst.Name, inst.Owner, "OS is not managed")
+		}
+	}
+}
+
+// auditBoxes adds the findings of @boxes to @report.
+func (c *Client) auditBoxes(report *AuditReport, boxes []Box) {
+	var personal = make(map[string]bool) // whether the workspace of an owner is personal
+
+	for i := range boxes {
+		var b = &boxes[i]
+
+		if b.Deleted != nil && !b.Deleted.Time.IsZero() {
+			continue
+		}
+		report.Boxes++
+
+		if b.Visibility == Visibility_Public && b.Owner != "" {
+			if _, ok := personal[b.Owner]; !ok {
+				ws, err := c.GetWorkSpace(b.Owner)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("failed to query workspace %s: %s", b.Owner, err))
+				}
+				personal[b.Owner] = err == nil && strings.HasSuffix(ws.Schema.String(), "/personal")
+			}
+			if personal[b.Owner] {
+				report.add(AuditPublicPersonalBox, "box", b.ID.String(), b.Name, b.Owner,
+					"public box owned by personal workspace %s", b.Owner)
+			}
+		}
+
+		for _, v := range b.Variables {
+			if strings.EqualFold(v.Type, "Password") && v.Value != "" {
+				report.add(AuditDefaultPassword, "box", b.ID.String(), b.Name, b.Owner,
+					"Password variable %s has a default value", v.Name)
+			}
+		}
+	}
+}
+
+// LatestBoxVersion returns the highest version among the box @versions.
+func LatestBoxVersion(versions []Box) (latest semver.Version, ok bool) {
+	for i := range versions {
+		if versions[i].BoxVersion == nil {
+			continue
+		} else if v := versions[i].Version(); !ok || latest.LessThan(v) {
+			latest, ok = v, true
+		}
+	}
+	return latest, ok
+}
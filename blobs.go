@@ -1,11 +1,22 @@
 package clccam
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
 	"path"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
 
+// Path prefix of the URLs of uploaded files.
+const BlobDownloadPath = "/services/blobs/download/"
+
 // BlobResponse is returned when uploading a file via POST.
 type BlobResponse struct {
 	// Url from which the uploaded file can be retrieved, e.g. "/services/blobs/download/5c1abf95939a600ea38a8661/test.sh"
@@ -30,3 +41,102 @@ func (c *Client) UploadFile(name string, b []byte) (res BlobResponse, err error)
 	}
 	return res, c.getResponse("/services/blobs/upload/"+path.Base(name), "POST", b, &res)
 }
+
+// DownloadFile retrieves the contents of the blob at @u, e.g. "/services/blobs/download/5c1abf95939a600ea38a8661/test.sh".
+func (c *Client) DownloadFile(u URI) (res []byte, err error) {
+	if u.IsZero() {
+		return nil, errors.Errorf("invalid/empty blob URL")
+	}
+	return res, c.Get(u.RequestURI(), &res)
+}
+
+// IsBlobURL returns true if @s refers to an uploaded file, rather than e.g. a relative path within a box directory.
+func IsBlobURL(s string) bool {
+	if u, err := url.Parse(s); err == nil {
+		return strings.HasPrefix(u.Path, BlobDownloadPath)
+	}
+	return false
+}
+
+// BlobCache remembers uploaded files by content, so that unchanged files are not uploaded again.
+// Since blobs are specific to a CAM endpoint, the cache file stores the blobs of each endpoint separately.
+type BlobCache struct {
+	mu       sync.Mutex
+	file     string                             // cache file, or empty if not persisted
+	endpoint string                             // base URL of the CAM endpoint
+	all      map[string]map[string]BlobResponse // endpoint -> blobKey -> uploaded file
+	blobs    map[string]BlobResponse            // entries of @endpoint
+}
+
+// NewBlobCache returns an empty in-memory BlobCache.
+func NewBlobCache() *BlobCache {
+	return &BlobCache{blobs: make(map[string]BlobResponse)}
+}
+
+// LoadBlobCache loads the cache file @file, using the entries of @endpoint (see Client.BaseURL).
+// A missing file yields an empty cache.
+func LoadBlobCache(file, endpoint string) (*BlobCache, error) {
+	var bc = &BlobCache{file: file, endpoint: endpoint, all: make(map[string]map[string]BlobResponse)}
+
+	if b, err := ioutil.ReadFile(file); err == nil {
+		if err := json.Unmarshal(b, &bc.all); err != nil {
+			return nil, errors.Wrapf(err, "failed to deserialize %s", file)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Errorf("unable to read blob cache: %s", err)
+	}
+
+	if bc.blobs = bc.all[endpoint]; bc.blobs == nil {
+		bc.blobs = make(map[string]BlobResponse)
+		bc.all[endpoint] = bc.blobs
+	}
+	return bc, nil
+}
+
+// Save writes @bc back to the file it was loaded from.
+func (bc *BlobCache) Save() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.file == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(bc.all, "", "\t")
+	if err != nil {
+		return err
+	} else if err := os.MkdirAll(path.Dir(bc.file), 0700); err != nil {
+		return errors.Errorf("failed to create directory for %s: %s", bc.file, err)
+	}
+	return ioutil.WriteFile(bc.file, b, 0600)
+}
+
+// blobKey identifies file @name with content @b. The name is part of the key, since it is part of the blob URL.
+func blobKey(name string, b []byte) string {
+	var sum = sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]) + "/" + path.Base(name)
+}
+
+// UploadFileCached is like UploadFile, but reuses the upload recorded in @cache if the file has not changed.
+// If @valid is non-nil, a cached upload is only reused if @valid returns true for it, e.g. to ensure that
+// the blob is still referenced and hence has not been removed from the server.
+// Returns true in @cached if the upload was skipped.
+func (c *Client) UploadFileCached(cache *BlobCache, name string, b []byte, valid func(BlobResponse) bool) (res BlobResponse, cached bool, err error) {
+	var key = blobKey(name, b)
+
+	cache.mu.Lock()
+	res, cached = cache.blobs[key]
+	cache.mu.Unlock()
+
+	if cached && (valid == nil || valid(res)) {
+		return res, true, nil
+	} else if res, err = c.UploadFile(name, b); err != nil {
+		return res, false, err
+	}
+
+	cache.mu.Lock()
+	cache.blobs[key] = res
+	cache.mu.Unlock()
+
+	return res, false, nil
+}
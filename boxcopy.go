@@ -0,0 +1,237 @@
+package clccam
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+ * Box Copy
+ *
+ * Copies a box to another owner, possibly on another CAM endpoint (e.g. from a development to a production organization).
+ */
+
+// BoxIDMap maps the IDs of source boxes to the IDs of their copies.
+type BoxIDMap map[string]string
+
+// LoadBoxIDMap reads the box ID mapping file @file. A missing file yields an empty mapping.
+func LoadBoxIDMap(file string) (BoxIDMap, error) {
+	var m = make(BoxIDMap)
+
+	if b, err := ioutil.ReadFile(file); os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, errors.Errorf("unable to read box ID map: %s", err)
+	} else if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize %s", file)
+	}
+	return m, nil
+}
+
+// Save writes @m to @file.
+func (m BoxIDMap) Save(file string) error {
+	if b, err := yaml.Marshal(m); err != nil {
+		return err
+	} else if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", file)
+	}
+	return nil
+}
+
+// CopyBoxOptions control CopyBox.
+type CopyBoxOptions struct {
+	Version    string   // Copy this version of the box (e.g. "1.2.0") instead of the draft
+	Owner      string   // Owner (workspace) of the copy
+	PreserveID bool     // Whether the copy keeps the ID of the source box (unless mapped by IDMap)
+	IDMap      BoxIDMap // Maps referenced box IDs, updated with the ID of the copy
+}
+
+// CopyBoxResult describes the outcome of CopyBox.
+type CopyBoxResult struct {
+	Box      *Box     // The copy
+	Updated  bool     // Whether an existing copy was updated
+	Blobs    int      // Number of files copied
+	Unmapped []string // IDs of referenced boxes that are not in the IDMap
+}
+
+// CopyBox copies box @boxId to the endpoint of @dst (which may be @c itself), uploading its files to @dst.
+// If @opts.IDMap already maps @boxId, the existing copy is updated. Box references of services and
+// Box variables are rewritten according to @opts.IDMap; references that are not mapped are reported.
+func (c *Client) CopyBox(dst *Client, boxId string, opts CopyBoxOptions) (*CopyBoxResult, error) {
+	var (
+		box          Box
+		err          error
+		res          = &CopyBoxResult{}
+		sameEndpoint = c.BaseURL() == dst.BaseURL()
+	)
+
+	if opts.Owner == "" {
+		return nil, errors.Errorf("no owner specified for the copy of box %s", boxId)
+	} else if opts.IDMap == nil {
+		opts.IDMap = make(BoxIDMap)
+	}
+
+	if opts.Version == "" {
+		if box, err = c.GetBoxDraft(boxId); err != nil {
+			return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+		}
+	} else if box, err = c.GetBoxVersion(boxId, opts.Version); err != nil {
+		return nil, err
+	}
+
+	// A box version has its own ID; other boxes refer to the box it is a version of.
+	var srcId = box.ID.String()
+	if box.BoxVersion != nil {
+		srcId = box.BoxVersion.Box.String()
+	}
+
+	// Files: blobs are shared within an endpoint, otherwise they have to be copied.
+	if !sameEndpoint {
+		err = rewriteBoxBlobs(&box, func(u URI) (BlobResponse, error) {
+			b, err := c.DownloadFile(u)
+			if err != nil {
+				return BlobResponse{}, errors.Wrapf(err, "failed to download %s", u.Path)
+			}
+			res.Blobs++
+			return dst.UploadFile(path.Base(u.Path), b)
+		})
+		if err != nil {
+			return nil, err
+		}
+		// The provider is specific to the source endpoint.
+		box.ProviderID = nil
+	}
+
+	// References to other boxes
+	mapId := func(id string) string {
+		if mapped, ok := opts.IDMap[id]; ok {
+			return mapped
+		}
+		res.Unmapped = append(res.Unmapped, id)
+		return id
+	}
+	for i, s := range box.Services {
+		if !uuid.Equal(uuid.Nil, s.Box.ID) {
+			if box.Services[i].Box.ID, err = uuid.FromString(mapId(s.Box.ID.String())); err != nil {
+				return nil, errors.Wrapf(err, "invalid box ID mapping for service %s", s.Name)
+			}
+		}
+	}
+	for i, v := range box.Variables {
+		if v.Type == "Box" && v.Value != "" {
+			box.Variables[i].Value = mapId(v.Value)
+		}
+	}
+	if sameEndpoint {
+		res.Unmapped = nil // the source boxes remain valid references
+	}
+
+	// Identity of the copy
+	var targetId = opts.IDMap[srcId]
+	if targetId == "" && opts.PreserveID {
+		targetId = srcId
+	}
+	if targetId == "" {
+		box.ID, err = uuid.NewV4()
+	} else {
+		box.ID, err = uuid.FromString(targetId)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ID for the copy of box %s", srcId)
+	}
+
+	if sameEndpoint && targetId == srcId {
+		return nil, errors.Errorf("the copy of box %s can not keep its ID on the same endpoint", srcId)
+	}
+
+	// An existing copy keeps its sharing and organization.
+	box.Owner = opts.Owner
+	box.Members = []WorkSpaceMember{}
+	if targetId != "" {
+		if existing, err := dst.GetBoxDraft(targetId); err == nil {
+			res.Updated = true
+			if len(existing.Members) > 0 {
+				box.Members = existing.Members
+			}
+			box.Organization = existing.Organization
+		}
+	}
+	box.URI, box.DraftFrom, box.BoxVersion = nil, nil, nil
+	box.Created, box.Updated, box.Deleted = Timestamp{Time: time.Now().UTC()}, nil, nil
+
+	if res.Updated {
+		res.Box, err = dst.UploadBox(&box, box.ID.String())
+	} else {
+		res.Box, err = dst.UploadBox(&box, "")
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to upload copy of box %s", srcId)
+	}
+	opts.IDMap[srcId] = res.Box.ID.String()
+	return res, nil
+}
+
+// rewriteBoxBlobs replaces the files referenced by @box by the results of calling @fn on their blob URLs.
+func rewriteBoxBlobs(box *Box, fn func(u URI) (BlobResponse, error)) error {
+	for evt, e := range box.Events {
+		if !e.Url.IsZero() {
+			r, err := fn(e.Url)
+			if err != nil {
+				return errors.Wrapf(err, "%s event", evt)
+			}
+			e.BlobResponse = r
+			box.Events[evt] = e
+		}
+	}
+	if !box.Readme.Url.IsZero() {
+		r, err := fn(box.Readme.Url)
+		if err != nil {
+			return errors.Wrapf(err, "readme")
+		}
+		box.Readme = r
+	}
+	if box.IconMetadata != nil && IsBlobURL(box.IconMetadata.Image.String()) {
+		r, err := fn(box.IconMetadata.Image)
+		if err != nil {
+			return errors.Wrapf(err, "icon")
+		}
+		box.IconMetadata.Image = r.Url
+	} else if IsBlobURL(box.Icon) {
+		u, err := UriFromString(box.Icon)
+		if err != nil {
+			return err
+		}
+		r, err := fn(*u)
+		if err != nil {
+			return errors.Wrapf(err, "icon")
+		}
+		box.Icon = r.Url.String()
+	}
+	if box.Template != nil && IsBlobURL(box.Template.Url.String()) {
+		r, err := fn(box.Template.Url)
+		if err != nil {
+			return errors.Wrapf(err, "template")
+		}
+		box.Template = &r
+	}
+	for i, v := range box.Variables {
+		if v.Type == "File" && IsBlobURL(v.Value) {
+			u, err := UriFromString(v.Value)
+			if err != nil {
+				return err
+			}
+			r, err := fn(*u)
+			if err != nil {
+				return errors.Wrapf(err, "File variable %s", v.Name)
+			}
+			box.Variables[i].Value = r.Url.String()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package clccam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+/*
+ * Box Diff
+ *
+ * Client-side comparison of boxes, box versions and box directories.
+ * Each side is reduced to a BoxSnapshot: the box definition, with references to files removed,
+ * and the contents of these files, indexed by a name that does not depend on where the file is stored.
+ */
+
+// BoxSnapshot is the content of a box, independent of where it is stored.
+type BoxSnapshot struct {
+	// Description of where the snapshot was taken from, e.g. the box ID or directory
+	Source string
+
+	// Box definition, with file references (events, readme, icon, template, File variables) cleared
+	Box Box
+
+	// File contents, indexed by "events/<event>", "readme", "icon", "template" or "variables/<name>"
+	Files map[string][]byte
+}
+
+// Fields of the box definition that change with every upload, and are hence not compared.
+var boxDiffIgnored = map[string]bool{"created": true, "updated": true, "deleted": true, "uri": true}
+
+// GetBoxSnapshot fetches the draft of box @boxId, or version @version of it (if non-empty), including the contents of its files.
+func (c *Client) GetBoxSnapshot(boxId, version string) (*BoxSnapshot, error) {
+	var box Box
+	var err error
+
+	if version == "" {
+		if box, err = c.GetBoxDraft(boxId); err != nil {
+			return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+		}
+	} else if box, err = c.GetBoxVersion(boxId, version); err != nil {
+		return nil, err
+	}
+
+	var s = &BoxSnapshot{Source: boxId, Files: make(map[string][]byte)}
+	if version != "" {
+		s.Source += " version " + version
+	}
+
+	// @fetch retrieves the blob at @ref into @name, unless @ref is empty.
+	fetch := func(name, ref string) error {
+		if ref == "" {
+			return nil
+		}
+		u, err := UriFromString(ref)
+		if err != nil {
+			return err
+		} else if s.Files[name], err = c.DownloadFile(*u); err != nil {
+			return errors.Wrapf(err, "failed to download %s", name)
+		}
+		return nil
+	}
+
+	for evt, e := range box.Events {
+		if err := fetch(path.Join(BoxEventsDir, evt.String()), e.Url.String()); err != nil {
+			return nil, err
+		}
+	}
+	if err := fetch("readme", box.Readme.Url.String()); err != nil {
+		return nil, err
+	}
+	if box.IconMetadata != nil && IsBlobURL(box.IconMetadata.Image.String()) {
+		if err := fetch("icon", box.IconMetadata.Image.String()); err != nil {
+			return nil, err
+		}
+	} else if IsBlobURL(box.Icon) {
+		if err := fetch("icon", box.Icon); err != nil {
+			return nil, err
+		}
+	}
+	if box.Template != nil {
+		if err := fetch("template", box.Template.Url.String()); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range box.Variables {
+		if v.Type == "File" && IsBlobURL(v.Value) {
+			if err := fetch("variables/"+v.Name, v.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.Box = box
+	s.clearFileReferences()
+	return s, nil
+}
+
+// LoadBoxSnapshot reads the box directory @dir, using the same layout as the 'box import' command.
+// File variables that still refer to uploaded files are downloaded.
+func (c *Client) LoadBoxSnapshot(dir string) (*BoxSnapshot, error) {
+	var s = &BoxSnapshot{Source: dir, Files: make(map[string][]byte)}
+
+	// Sometimes a 'draft' directory is inserted between the directory and its contents.
+	if _, err := os.Stat(path.Join(dir, "draft", BoxFileName)); err == nil {
+		dir = path.Join(dir, "draft")
+	}
+
+	if content, err := ioutil.ReadFile(path.Join(dir, BoxFileName)); err != nil {
+		return nil, errors.Errorf("unable to read %s: %s", BoxFileName, err)
+	} else if err = yaml.Unmarshal(content, &s.Box); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize %s", BoxFileName)
+	}
+	if s.Box.Schema.IsZero() {
+		u, err := UriFromString(ScriptBoxSchema)
+		if err != nil {
+			return nil, err
+		}
+		s.Box.Schema = *u
+	}
+
+	// @read reads the file at @rel (relative to @dir) into @name, or downloads it if @rel is a blob URL.
+	read := func(name, rel string) (err error) {
+		if IsBlobURL(rel) {
+			u, err := UriFromString(rel)
+			if err != nil {
+				return err
+			}
+			s.Files[name], err = c.DownloadFile(*u)
+			return errors.Wrapf(err, "failed to download %s", name)
+		} else if s.Files[name], err = ioutil.ReadFile(path.Join(dir, rel)); err != nil {
+			return errors.Errorf("unable to read %s: %s", name, err)
+		}
+		return nil
+	}
+
+	if s.Box.Schema.String() == ScriptBoxSchema {
+		for _, evt := range BoxEventStrings() {
+			if _, err := os.Stat(path.Join(dir, BoxEventsDir, evt)); err == nil {
+				if err := read(path.Join(BoxEventsDir, evt), path.Join(BoxEventsDir, evt)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, ReadmeName)); err == nil {
+		if err := read("readme", ReadmeName); err != nil {
+			return nil, err
+		}
+	}
+	if m := s.Box.IconMetadata; m != nil && !m.Image.IsZero() {
+		if p := m.Image.Path; IsBlobURL(m.Image.String()) || !strings.HasPrefix(p, "images/") {
+			if err := read("icon", m.Image.String()); err != nil {
+				return nil, err
+			}
+		}
+	} else if s.Box.Icon != "" {
+		if err := read("icon", s.Box.Icon); err != nil {
+			return nil, err
+		}
+	}
+	if t := s.Box.Template; t != nil && !t.Url.IsZero() {
+		if err := read("template", t.Url.String()); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range s.Box.Variables {
+		if v.Type == "File" && v.Value != "" {
+			if err := read("variables/"+v.Name, v.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.clearFileReferences()
+	return s, nil
+}
+
+// clearFileReferences removes the references to the files of @s from its box definition.
+func (s *BoxSnapshot) clearFileReferences() {
+	s.Box.Events = nil
+	s.Box.Readme = BlobResponse{}
+
+	if _, ok := s.Files["icon"]; ok {
+		if s.Box.IconMetadata != nil {
+			s.Box.IconMetadata.Image = URI{}
+		}
+		s.Box.Icon = ""
+	}
+	if _, ok := s.Files["template"]; ok {
+		s.Box.Template = nil
+	}
+	for i, v := range s.Box.Variables {
+		if _, ok := s.Files["variables/"+v.Name]; ok && v.Type == "File" {
+			s.Box.Variables[i].Value = ""
+		}
+	}
+}
+
+// FieldChange is a difference in a single field of two box definitions.
+type FieldChange struct {
+	// Path of the field, e.g. "variables[port].value"
+	Field string `json:"field"`
+
+	// Old and new value, as JSON (empty if not present)
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (f FieldChange) String() string {
+	switch {
+	case f.Old == "":
+		return fmt.Sprintf("+ %s: %s", f.Field, f.New)
+	case f.New == "":
+		return fmt.Sprintf("- %s: %s", f.Field, f.Old)
+	}
+	return fmt.Sprintf("~ %s: %s => %s", f.Field, f.Old, f.New)
+}
+
+// FileDiff is a difference in the contents of a box file.
+type FileDiff struct {
+	// Name of the file, e.g. "events/install"
+	Name string `json:"name"`
+
+	// Unified diff, empty for binary files
+	Diff string `json:"diff,omitempty"`
+
+	// Set if either side is not valid UTF-8 text
+	Binary bool `json:"binary,omitempty"`
+}
+
+// BoxDiff describes the differences between two box snapshots.
+type BoxDiff struct {
+	From   string        `json:"from"`
+	To     string        `json:"to"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	Files  []FileDiff    `json:"files,omitempty"`
+}
+
+// IsEmpty returns true if @d contains no differences.
+func (d *BoxDiff) IsEmpty() bool {
+	return len(d.Fields) == 0 && len(d.Files) == 0
+}
+
+// DiffBoxes compares @from against @to.
+func DiffBoxes(from, to *BoxSnapshot) (*BoxDiff, error) {
+	var d = &BoxDiff{From: from.Source, To: to.Source}
+
+	a, err := flattenBox(&from.Box)
+	if err != nil {
+		return nil, err
+	}
+	b, err := flattenBox(&to.Box)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range unionKeys(a, b) {
+		if a[field] != b[field] {
+			d.Fields = append(d.Fields, FieldChange{Field: field, Old: a[field], New: b[field]})
+		}
+	}
+
+	var names = make(map[string]string)
+	for name := range from.Files {
+		names[name] = ""
+	}
+	for name := range to.Files {
+		names[name] = ""
+	}
+	for _, name := range unionKeys(names, nil) {
+		var old, cur = from.Files[name], to.Files[name]
+
+		if bytes.Equal(old, cur) {
+			continue
+		} else if !utf8.Valid(old) || !utf8.Valid(cur) {
+			d.Files = append(d.Files, FileDiff{Name: name, Binary: true})
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        diffLines(string(old)),
+			B:        diffLines(string(cur)),
+			FromFile: path.Join("a", name),
+			ToFile:   path.Join("b", name),
+			Context:  3,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to diff %s", name)
+		}
+		d.Files = append(d.Files, FileDiff{Name: name, Diff: diff})
+	}
+	return d, nil
+}
+
+// diffLines splits @s into newline-terminated lines.
+func diffLines(s string) []string {
+	var lines = strings.SplitAfter(s, "\n")
+
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// flattenBox maps each (leaf) field of @b to its JSON value.
+func flattenBox(b *Box) (map[string]string, error) {
+	var (
+		v   interface{}
+		res = make(map[string]string)
+	)
+
+	if content, err := json.Marshal(b); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(content, &v); err != nil {
+		return nil, err
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		for key := range boxDiffIgnored {
+			delete(m, key)
+		}
+	}
+	flattenJSON("", v, res)
+	return res, nil
+}
+
+// flattenJSON adds the leaves of @v, located at @prefix, to @res.
+// Elements of arrays of objects that have a "name" are identified by name, others by index.
+func flattenJSON(prefix string, v interface{}, res map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if prefix == "" {
+				flattenJSON(key, val, res)
+			} else {
+				flattenJSON(prefix+"."+key, val, res)
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			if m, ok := val.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					flattenJSON(fmt.Sprintf("%s[%s]", prefix, name), val, res)
+					continue
+				}
+			}
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), val, res)
+		}
+	case nil:
+		// Treat null like a missing field.
+	default:
+		b, _ := json.Marshal(v)
+		res[prefix] = string(b)
+	}
+}
+
+// unionKeys returns the sorted union of the keys of @a and @b.
+func unionKeys(a, b map[string]string) (keys []string) {
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
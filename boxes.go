@@ -11,6 +11,19 @@ import (
 // A box having this schema identifies itself as a Script Box.
 const ScriptBoxSchema = "http://elasticbox.net/schemas/boxes/script"
 
+// Schemas of the other box types.
+const (
+	PolicyBoxSchema         = "http://elasticbox.net/schemas/boxes/policy"
+	CloudFormationBoxSchema = "http://elasticbox.net/schemas/boxes/cloudformation"
+	CompositeBoxSchema      = "http://elasticbox.net/schemas/boxes/composite"
+)
+
+// BoxSchemas lists the known box schemas.
+var BoxSchemas = []string{ScriptBoxSchema, PolicyBoxSchema, CloudFormationBoxSchema, CompositeBoxSchema}
+
+// Types of box variables.
+var BoxVariableTypes = []string{"Text", "Password", "Port", "Number", "Options", "File", "Box", "Binding"}
+
 // The expected file name for README files.
 const ReadmeName = "readme.MD"
 
@@ -273,8 +286,20 @@ func (c *Client) GetBoxVersions(boxId string) (res []Box, err error) {
 	return res, c.Get(fmt.Sprintf("/services/boxes/%s/versions", boxId), &res)
 }
 
+// GetBoxVersion returns version @version (e.g. "1.2.0") of @boxId.
+func (c *Client) GetBoxVersion(boxId, version string) (res Box, err error) {
+	versions, err := c.GetBoxVersions(boxId)
+	if err != nil {
+		return res, errors.Wrapf(err, "failed to query versions of box %s", boxId)
+	}
+	if res, err = FindBoxVersion(versions, version); err != nil {
+		return res, errors.Wrapf(err, "box %s", boxId)
+	}
+	return res, nil
+}
+
 // GetBoxDiff returns the differences of @boxId.
-// FIXME: no documentation for this method and the call returns 405 (not allowed).
+// FIXME: no documentation for this method and the call returns 405 (not allowed). Use DiffBoxes instead.
 func (c *Client) GetBoxDiff(boxId string) error {
 	return c.Get(fmt.Sprintf("/services/boxes/%s/diff", boxId), nil)
 }
@@ -0,0 +1,240 @@
+package clccam
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+ * Box Dependency Graph
+ *
+ * Boxes refer to other boxes through their services, Box variables, stack and bindings,
+ * and through requirements that are satisfied by the claims of (policy) boxes.
+ */
+
+// BoxEdgeKind identifies how one box refers to another.
+type BoxEdgeKind string
+
+const (
+	BoxEdgeService  BoxEdgeKind = "service"  // Services[].Box.ID
+	BoxEdgeVariable BoxEdgeKind = "variable" // value of a Box variable
+	BoxEdgeClaim    BoxEdgeKind = "claim"    // a requirement claimed by the target box
+	BoxEdgeStack    BoxEdgeKind = "stack"    // member of the box stack
+	BoxEdgeBinding  BoxEdgeKind = "binding"  // box that can be bound
+)
+
+// IsDependency returns true if the source of an edge of kind @k pulls in its target.
+func (k BoxEdgeKind) IsDependency() bool {
+	return k == BoxEdgeService || k == BoxEdgeVariable || k == BoxEdgeClaim
+}
+
+// BoxNode is a box within a BoxGraph.
+type BoxNode struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+	Schema       string   `json:"schema,omitempty"`
+	Requirements []string `json:"requirements,omitempty"`
+	Claims       []string `json:"claims,omitempty"`
+
+	// Set if the box could not be resolved
+	Error string `json:"error,omitempty"`
+}
+
+// BoxEdge is a reference from box @From to box @To.
+type BoxEdge struct {
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Kind  BoxEdgeKind `json:"kind"`
+	Label string      `json:"label,omitempty"` // service or variable name, or requirement
+}
+
+// BoxGraph is the result of resolving the references of a box.
+type BoxGraph struct {
+	Root  string              `json:"root"`
+	Nodes map[string]*BoxNode `json:"nodes"`
+	Edges []BoxEdge           `json:"edges"`
+
+	// Dependency cycles, each listing the box IDs along the cycle
+	Cycles [][]string `json:"cycles,omitempty"`
+}
+
+// BoxGraphOptions control ResolveBoxGraph.
+type BoxGraphOptions struct {
+	Parallel int  // Number of concurrent requests
+	MaxDepth int  // Maximum distance from the root box (0 means unlimited)
+	Stack    bool // Whether to follow the box stack
+	Bindings bool // Whether to follow box bindings
+	Claims   bool // Whether to resolve requirements to the boxes claiming them
+}
+
+// ResolveBoxGraph walks the references of @boxId recursively, fetching each level of boxes concurrently.
+// Boxes that can not be fetched are included with their Error set; only failure to fetch @boxId is an error.
+func (c *Client) ResolveBoxGraph(boxId string, opts BoxGraphOptions) (*BoxGraph, error) {
+	var (
+		g        = &BoxGraph{Root: boxId, Nodes: make(map[string]*BoxNode)}
+		frontier = []string{boxId}
+		seen     = make(map[BoxEdge]bool)
+		claimers map[string][]Box // requirement -> boxes claiming it
+	)
+
+	if opts.Claims {
+		boxes, err := c.GetBoxes()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to query boxes")
+		}
+		claimers = make(map[string][]Box)
+		for _, b := range boxes {
+			for _, claim := range b.Claims {
+				claimers[claim] = append(claimers[claim], b)
+			}
+		}
+	}
+
+	for depth := 0; len(frontier) > 0; depth++ {
+		var (
+			boxes    = make(map[string]Box)
+			stacks   = make(map[string][]Box)
+			bindings = make(map[string][]BoxBinding)
+			next     []string
+		)
+
+		errs := c.forEachID(frontier, opts.Parallel, func(id string) (func(), error) {
+			var stack []Box
+			var binds []BoxBinding
+
+			box, err := c.GetBox(id)
+			if err != nil {
+				return nil, err
+			}
+			if opts.Stack {
+				if stack, err = c.GetBoxStack(id); err != nil {
+					return nil, errors.Wrapf(err, "failed to query stack")
+				}
+			}
+			if opts.Bindings {
+				if binds, err = c.GetBoxBindings(id); err != nil {
+					return nil, errors.Wrapf(err, "failed to query bindings")
+				}
+			}
+			return func() {
+				boxes[id], stacks[id], bindings[id] = box, stack, binds
+			}, nil
+		})
+		if err, ok := errs[boxId]; ok && depth == 0 {
+			return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+		}
+
+		// @link records an edge, and schedules its target unless already known.
+		link := func(e BoxEdge) {
+			if e.To == "" || e.To == uuid.Nil.String() || seen[e] {
+				return
+			}
+			seen[e] = true
+			g.Edges = append(g.Edges, e)
+			if _, ok := g.Nodes[e.To]; !ok {
+				g.Nodes[e.To] = &BoxNode{ID: e.To}
+				next = append(next, e.To)
+			}
+		}
+
+		for _, id := range frontier {
+			var node = g.Nodes[id]
+
+			if node == nil {
+				node = &BoxNode{ID: id}
+				g.Nodes[id] = node
+			}
+			if err, ok := errs[id]; ok {
+				node.Error = err.Error()
+				continue
+			}
+
+			box := boxes[id]
+			node.Name, node.Owner, node.Schema = box.Name, box.Owner, box.Schema.String()
+			node.Requirements, node.Claims = box.Requirements, box.Claims
+
+			if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+				continue
+			}
+			for _, s := range box.Services {
+				link(BoxEdge{From: id, To: s.Box.ID.String(), Kind: BoxEdgeService, Label: s.Name})
+			}
+			for _, v := range box.Variables {
+				if v.Type == "Box" {
+					link(BoxEdge{From: id, To: v.Value, Kind: BoxEdgeVariable, Label: v.Name})
+				}
+			}
+			for _, r := range box.Requirements {
+				for _, b := range claimers[r] {
+					if b.ID.String() != id {
+						link(BoxEdge{From: id, To: b.ID.String(), Kind: BoxEdgeClaim, Label: r})
+					}
+				}
+			}
+			for _, b := range stacks[id] {
+				if b.ID.String() != id {
+					link(BoxEdge{From: id, To: b.ID.String(), Kind: BoxEdgeStack})
+				}
+			}
+			for _, b := range bindings[id] {
+				if b.ID.String() != id {
+					link(BoxEdge{From: id, To: b.ID.String(), Kind: BoxEdgeBinding, Label: b.Name})
+				}
+			}
+		}
+		frontier = next
+	}
+
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].Kind < g.Edges[j].Kind
+	})
+	g.Cycles = g.findCycles()
+	return g, nil
+}
+
+// Children returns the outgoing edges of @id, in the order of g.Edges.
+func (g *BoxGraph) Children(id string) (res []BoxEdge) {
+	for _, e := range g.Edges {
+		if e.From == id {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// findCycles returns the dependency cycles of @g, found by depth-first search from the root.
+func (g *BoxGraph) findCycles() (cycles [][]string) {
+	var (
+		done   = make(map[string]bool)
+		onPath = make(map[string]int) // node -> index in @path
+		path   []string
+		visit  func(id string)
+	)
+
+	visit = func(id string) {
+		onPath[id] = len(path)
+		path = append(path, id)
+
+		for _, e := range g.Children(id) {
+			if !e.Kind.IsDependency() {
+				continue
+			} else if i, ok := onPath[e.To]; ok {
+				cycles = append(cycles, append(append([]string{}, path[i:]...), e.To))
+			} else if !done[e.To] {
+				visit(e.To)
+			}
+		}
+
+		path = path[:len(path)-1]
+		delete(onPath, id)
+		done[id] = true
+	}
+	visit(g.Root)
+	return cycles
+}
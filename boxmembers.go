@@ -0,0 +1,125 @@
+package clccam
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Members
+ *
+ * A box is shared by adding workspaces, with a role, to its members.
+ */
+
+// Roles of box members.
+const (
+	BoxRoleCollaborator = "collaborator" // may edit the box
+	BoxRoleViewer       = "viewer"       // may view and deploy the box
+)
+
+// BoxRoles lists the valid roles of box members.
+var BoxRoles = []string{BoxRoleCollaborator, BoxRoleViewer}
+
+// InvalidBoxMember is a member entry that was removed by CleanBoxMembers.
+type InvalidBoxMember struct {
+	WorkSpaceMember
+	Reason string `json:"reason"`
+}
+
+func (m InvalidBoxMember) String() string {
+	return fmt.Sprintf("%q (%s): %s", m.Workspace, m.Role, m.Reason)
+}
+
+// CleanBoxMembers returns the valid entries of @members, and the invalid ones. Entries are invalid if they
+// have an empty or non-existent workspace, an unknown role, or repeat the workspace of a previous entry.
+// Entries whose workspace can not be checked (e.g. due to a 403 response) are kept in @valid, and are
+// also returned in @unchecked, so that callers do not drop members that may well be valid.
+func (c *Client) CleanBoxMembers(members []WorkSpaceMember) (valid []WorkSpaceMember, invalid, unchecked []InvalidBoxMember) {
+	var (
+		seen   = make(map[string]bool)
+		exists = make(map[string]error) // workspace -> lookup result
+	)
+
+	valid = []WorkSpaceMember{} // the API expects a list, not null
+	for _, m := range members {
+		var reason string
+
+		if _, ok := exists[m.Workspace]; !ok && m.Workspace != "" {
+			_, exists[m.Workspace] = c.GetWorkSpace(m.Workspace)
+		}
+
+		switch {
+		case strings.TrimSpace(m.Workspace) == "":
+			reason = "empty workspace"
+		case !stringInSlice(m.Role, BoxRoles):
+			reason = fmt.Sprintf("invalid role %q", m.Role)
+		case seen[m.Workspace]:
+			reason = "duplicate entry"
+		case IsNotFound(exists[m.Workspace]):
+			reason = fmt.Sprintf("unknown workspace: %s", exists[m.Workspace])
+		case exists[m.Workspace] != nil:
+			unchecked = append(unchecked, InvalidBoxMember{m, fmt.Sprintf("unable to check workspace: %s", exists[m.Workspace])})
+		}
+
+		if reason != "" {
+			invalid = append(invalid, InvalidBoxMember{m, reason})
+		} else {
+			seen[m.Workspace] = true
+			valid = append(valid, m)
+		}
+	}
+	return valid, invalid, unchecked
+}
+
+// ShareBox shares box @boxId with @workspace, using @role (one of BoxRoles).
+// If @workspace already is a member, its role is updated. Invalid member entries are removed.
+func (c *Client) ShareBox(boxId, workspace, role string) (*Box, error) {
+	if !stringInSlice(role, BoxRoles) {
+		return nil, errors.Errorf("invalid role %q (expecting %s)", role, strings.Join(BoxRoles, " or "))
+	} else if _, err := c.GetWorkSpace(workspace); err != nil {
+		return nil, errors.Wrapf(err, "invalid workspace %q", workspace)
+	}
+
+	box, err := c.GetBoxDraft(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+	} else if box.Owner == workspace {
+		return nil, errors.Errorf("%s is the owner of box %s", workspace, boxId)
+	}
+
+	var found bool
+	box.Members, _, _ = c.CleanBoxMembers(box.Members) // members that can not be checked are kept
+	for i := range box.Members {
+		if box.Members[i].Workspace == workspace {
+			box.Members[i].Role, found = role, true
+		}
+	}
+	if !found {
+		box.Members = append(box.Members, WorkSpaceMember{Role: role, Workspace: workspace})
+	}
+	return c.UploadBox(&box, boxId)
+}
+
+// UnshareBox removes @workspace from the members of box @boxId. Invalid member entries are removed, too.
+func (c *Client) UnshareBox(boxId, workspace string) (*Box, error) {
+	var members = []WorkSpaceMember{}
+
+	box, err := c.GetBoxDraft(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+	}
+
+	valid, _, _ := c.CleanBoxMembers(box.Members)
+	for _, m := range valid {
+		if m.Workspace != workspace {
+			members = append(members, m)
+		}
+	}
+	if len(members) == len(valid) {
+		return nil, errors.Errorf("box %s is not shared with %s", boxId, workspace)
+	}
+	box.Members = members
+	return c.UploadBox(&box, boxId)
+}
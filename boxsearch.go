@@ -0,0 +1,221 @@
+package clccam
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Search
+ */
+
+// BoxQuery selects and orders boxes. Empty fields match all boxes.
+type BoxQuery struct {
+	Category   string // Box category, e.g. "Continuous Integration"
+	Owner      string // Box owner
+	Visibility string // One of VisibilityStrings()
+	Schema     string // Box type (e.g. "script") or schema URI
+	Name       string // Glob pattern matching the name or friendly ID, e.g. "jen*"
+	Text       string // Text contained in the name, friendly ID, description or readme
+
+	// Sort order: one of "name", "created" or "updated" (most recent first), or empty to keep the API order.
+	SortBy string
+
+	// Whether to collapse the versions of each box into the latest one.
+	LatestOnly bool
+
+	// Number of concurrent readme downloads when searching by Text.
+	Parallel int
+}
+
+// Validate checks @q for invalid values.
+func (q *BoxQuery) Validate() error {
+	if q.Visibility != "" {
+		if _, err := VisibilityFromString(q.Visibility); err != nil {
+			return errors.Errorf("invalid visibility %q (expecting one of %s)", q.Visibility, strings.Join(VisibilityStrings(), ", "))
+		}
+	}
+	if q.Schema != "" && !strings.Contains(q.Schema, "/") {
+		if _, err := BoxTypeSchema(q.Schema); err != nil {
+			return err
+		}
+	}
+	if _, err := path.Match(strings.ToLower(q.Name), ""); err != nil {
+		return errors.Errorf("invalid name pattern %q: %s", q.Name, err)
+	}
+	switch q.SortBy {
+	case "", "name", "created", "updated":
+	default:
+		return errors.Errorf("invalid sort order %q (expecting name, created or updated)", q.SortBy)
+	}
+	return nil
+}
+
+// SearchBoxes returns the boxes of the personal workspace that match @q, in the order of @q.SortBy.
+// Boxes whose readme can not be downloaded are matched by their fields only, and reported in @warnings.
+func (c *Client) SearchBoxes(q BoxQuery) (res []Box, warnings []string, err error) {
+
+	if err := q.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	boxes, err := c.GetBoxes()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to query boxes")
+	}
+	if q.LatestOnly {
+		boxes = LatestBoxes(boxes)
+	}
+
+	// Fields other than the readme are checked first, to avoid downloading the readme of boxes that do not match.
+	var (
+		byId     = make(map[string]Box)
+		readmes  []string
+		matching = make(map[string]bool)
+	)
+	for _, b := range boxes {
+		if !q.matchFields(&b) {
+			continue
+		} else if q.Text == "" || q.matchText(&b) {
+			matching[b.ID.String()] = true
+		} else if !b.Readme.Url.IsZero() {
+			byId[b.ID.String()] = b
+			readmes = append(readmes, b.ID.String())
+		}
+	}
+
+	errs := c.forEachID(readmes, q.Parallel, func(id string) (func(), error) {
+		content, err := c.DownloadFile(byId[id].Readme.Url)
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			matching[id] = strings.Contains(strings.ToLower(string(content)), strings.ToLower(q.Text))
+		}, nil
+	})
+	for _, id := range readmes {
+		if err, ok := errs[id]; ok {
+			warnings = append(warnings, fmt.Sprintf("failed to download readme of box %s: %s", id, err))
+		}
+	}
+
+	for _, b := range boxes {
+		if matching[b.ID.String()] {
+			res = append(res, b)
+		}
+	}
+	sortBoxes(res, q.SortBy)
+	return res, warnings, nil
+}
+
+// matchFields returns true if the fields of @b, other than those searched by @q.Text, match @q.
+func (q *BoxQuery) matchFields(b *Box) bool {
+	if q.Owner != "" && b.Owner != q.Owner {
+		return false
+	} else if q.Visibility != "" && b.Visibility.String() != q.Visibility {
+		return false
+	}
+
+	if q.Category != "" {
+		var found bool
+
+		for _, c := range b.Categories {
+			if strings.EqualFold(c, q.Category) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if q.Schema != "" {
+		var schema = q.Schema
+
+		if !strings.Contains(schema, "/") {
+			schema, _ = BoxTypeSchema(schema)
+		}
+		if b.Schema.String() != schema {
+			return false
+		}
+	}
+
+	if q.Name != "" {
+		var pattern = strings.ToLower(q.Name)
+
+		nameMatch, _ := path.Match(pattern, strings.ToLower(b.Name))
+		idMatch, _ := path.Match(pattern, strings.ToLower(b.FriendlyID))
+		if !nameMatch && !idMatch {
+			return false
+		}
+	}
+	return true
+}
+
+// matchText returns true if the name, friendly ID or description of @b contains @q.Text.
+func (q *BoxQuery) matchText(b *Box) bool {
+	var text = strings.ToLower(q.Text)
+
+	for _, s := range []string{b.Name, b.FriendlyID, b.Description} {
+		if strings.Contains(strings.ToLower(s), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// LatestBoxes collapses the versions of each box in @boxes into the latest one.
+// A draft takes precedence over the versions it was created from.
+func LatestBoxes(boxes []Box) (res []Box) {
+	var (
+		latest = make(map[string]int) // box ID -> index into @res
+		boxId  = func(b *Box) string {
+			if b.BoxVersion != nil {
+				return b.BoxVersion.Box.String()
+			}
+			return b.ID.String()
+		}
+	)
+
+	for _, b := range boxes {
+		var id = boxId(&b)
+
+		if i, ok := latest[id]; !ok {
+			latest[id] = len(res)
+			res = append(res, b)
+		} else if cur := &res[i]; cur.BoxVersion != nil && (b.BoxVersion == nil || cur.Version().LessThan(b.Version())) {
+			res[i] = b
+		}
+	}
+	return res
+}
+
+// sortBoxes sorts @boxes by @sortBy (see BoxQuery).
+func sortBoxes(boxes []Box, sortBy string) {
+	updated := func(b *Box) Timestamp {
+		if b.Updated != nil {
+			return *b.Updated
+		}
+		return b.Created
+	}
+
+	switch sortBy {
+	case "name":
+		sort.SliceStable(boxes, func(i, j int) bool {
+			return strings.ToLower(boxes[i].Name) < strings.ToLower(boxes[j].Name)
+		})
+	case "created":
+		sort.SliceStable(boxes, func(i, j int) bool {
+			return boxes[i].Created.After(boxes[j].Created.Time)
+		})
+	case "updated":
+		sort.SliceStable(boxes, func(i, j int) bool {
+			return updated(&boxes[i]).After(updated(&boxes[j]).Time)
+		})
+	}
+}
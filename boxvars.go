@@ -0,0 +1,75 @@
+package clccam
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Variables
+ */
+
+// Variable returns the variable @name of @b, or nil if not present.
+func (b *Box) Variable(name string) *BoxVariable {
+	for i := range b.Variables {
+		if b.Variables[i].Name == name {
+			return &b.Variables[i]
+		}
+	}
+	return nil
+}
+
+// ValidateBoxVariable checks the name, type and value of @v.
+func ValidateBoxVariable(v *BoxVariable) error {
+	if !boxVariableName.MatchString(v.Name) {
+		return errors.Errorf("invalid variable name %q (letters, digits and '_' only)", v.Name)
+	} else if !stringInSlice(v.Type, BoxVariableTypes) {
+		return errors.Errorf("invalid type %q of variable %s (expecting one of %s)", v.Type, v.Name, strings.Join(BoxVariableTypes, ", "))
+	} else if err := CheckVariableValue(v); err != nil {
+		return errors.Wrapf(err, "variable %s", v.Name)
+	} else if v.Type == "File" && v.Value != "" && !IsBlobURL(v.Value) {
+		return errors.Errorf("value of File variable %s is not an uploaded file: %q", v.Name, v.Value)
+	}
+	return nil
+}
+
+// SetBoxVariable adds variable @v to the draft of box @boxId, or replaces the variable of the same name.
+func (c *Client) SetBoxVariable(boxId string, v BoxVariable) (*Box, error) {
+	if err := ValidateBoxVariable(&v); err != nil {
+		return nil, err
+	}
+
+	box, err := c.GetBoxDraft(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+	}
+
+	if cur := box.Variable(v.Name); cur != nil {
+		*cur = v
+	} else {
+		box.Variables = append(box.Variables, v)
+	}
+	return c.UploadBox(&box, boxId)
+}
+
+// RemoveBoxVariable removes variable @name from the draft of box @boxId.
+func (c *Client) RemoveBoxVariable(boxId, name string) (*Box, error) {
+	var variables = []BoxVariable{}
+
+	box, err := c.GetBoxDraft(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+	}
+
+	for _, v := range box.Variables {
+		if v.Name != name {
+			variables = append(variables, v)
+		}
+	}
+	if len(variables) == len(box.Variables) {
+		return nil, errors.Errorf("box %s has no variable %q", boxId, name)
+	}
+	box.Variables = variables
+	return c.UploadBox(&box, boxId)
+}
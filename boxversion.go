@@ -0,0 +1,126 @@
+package clccam
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Versions
+ *
+ * A box version is an immutable copy of the box draft, identified by a semantic version number.
+ */
+
+// VersionBump specifies which part of a box version number to increment.
+type VersionBump string
+
+const (
+	BumpMajor VersionBump = "major"
+	BumpMinor VersionBump = "minor"
+	BumpPatch VersionBump = "patch"
+)
+
+// Bump returns @v incremented according to @b.
+func (b VersionBump) Bump(v semver.Version) (semver.Version, error) {
+	switch b {
+	case BumpMajor:
+		v.BumpMajor()
+	case BumpMinor:
+		v.BumpMinor()
+	case BumpPatch:
+		v.BumpPatch()
+	default:
+		return v, errors.Errorf("invalid version bump %q (expecting major, minor or patch)", b)
+	}
+	return v, nil
+}
+
+// ParseBoxVersion parses the version number @s (e.g. "1.2.0").
+// Missing minor or patch numbers default to 0, so that "1.2" is the same as "1.2.0".
+// Box versions consist of major, minor and patch number only; pre-release and metadata suffixes are rejected.
+func ParseBoxVersion(s string) (semver.Version, error) {
+	var number = strings.TrimPrefix(strings.TrimSpace(s), "v")
+
+	if strings.ContainsAny(number, "-+") {
+		return semver.Version{}, errors.Errorf("invalid version %q: box versions can not have pre-release or metadata suffixes", s)
+	}
+	for n := strings.Count(number, "."); n < 2; n++ {
+		number += ".0"
+	}
+
+	v, err := semver.NewVersion(number)
+	if err != nil {
+		return semver.Version{}, errors.Wrapf(err, "invalid version %q", s)
+	}
+	return *v, nil
+}
+
+// FindBoxVersion returns the element of @versions whose version number equals @version (e.g. "1.2.0").
+func FindBoxVersion(versions []Box, version string) (Box, error) {
+	number, err := ParseBoxVersion(version)
+	if err != nil {
+		return Box{}, err
+	}
+	for _, v := range versions {
+		if v.BoxVersion != nil && v.Version().Equal(number) {
+			return v, nil
+		}
+	}
+	return Box{}, errors.Errorf("no version %s", version)
+}
+
+// GetBoxDraft returns the current draft of box @boxId.
+// Unlike GetBox, this does not fall back to the latest version of the box.
+func (c *Client) GetBoxDraft(boxId string) (res Box, err error) {
+	return res, c.Get("/services/boxes/"+boxId, &res)
+}
+
+// NextBoxVersion returns the version number following the latest version of @boxId according to @bump.
+// If the box has no versions yet, the number is bumped from 0.0.0.
+func (c *Client) NextBoxVersion(boxId string, bump VersionBump) (semver.Version, error) {
+	versions, err := c.GetBoxVersions(boxId)
+	if err != nil {
+		return semver.Version{}, errors.Wrapf(err, "failed to query versions of box %s", boxId)
+	}
+	latest, _ := LatestBoxVersion(versions)
+	return bump.Bump(latest)
+}
+
+// PublishBox creates version @number of box @boxId from its current draft, using @message as description.
+// Fails if @number is not greater than the latest existing version of the box.
+func (c *Client) PublishBox(boxId string, number semver.Version, message string) (*Box, error) {
+	var res Box
+
+	if number.PreRelease != "" || number.Metadata != "" {
+		return nil, errors.Errorf("invalid version %s: box versions can not have pre-release or metadata suffixes", number)
+	}
+
+	versions, err := c.GetBoxVersions(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query versions of box %s", boxId)
+	} else if latest, ok := LatestBoxVersion(versions); ok && !latest.LessThan(number) {
+		return nil, errors.Errorf("version %s of box %s is not greater than its latest version %s", number, boxId, latest)
+	}
+
+	draft, err := c.GetBoxDraft(boxId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+	}
+
+	draft.BoxVersion = &BoxVersion{
+		Box:         draft.ID,
+		Workspace:   draft.Owner,
+		Description: message,
+	}
+	draft.BoxVersion.Number.Major = number.Major
+	draft.BoxVersion.Number.Minor = number.Minor
+	draft.BoxVersion.Number.Patch = number.Patch
+
+	if err := c.getResponse(fmt.Sprintf("/services/boxes/%s/versions", boxId), "POST", &draft, &res); err != nil {
+		return nil, errors.Wrapf(err, "failed to publish version %s of box %s", number, boxId)
+	}
+	return &res, nil
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/dustin/go-humanize"
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentsFlags struct {
+		maxAge       time.Duration // Maximum time since the last agent ping
+		minVersion   string        // Minimum agent version
+		sortBy       string        // Sort order
+		problemsOnly bool          // Whether to list only unhealthy agents
+		parallel     int           // Number of concurrent service queries
+		output       string        // Output format
+	}
+
+	// Agent health report
+	agentsCmd = &cobra.Command{
+		Use:     "agents",
+		Aliases: []string{"agent"},
+		Short:   "Report machine agents that are stale, outdated or in an inconsistent state",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			switch agentsFlags.sortBy {
+			case "instance", "machine", "ping", "version", "state":
+			default:
+				return errors.Errorf("invalid sort order %q", agentsFlags.sortBy)
+			}
+			return checkOutputFormat(agentsFlags.output, "table", "json")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var check = clccam.AgentCheck{MaxPingAge: agentsFlags.maxAge}
+
+			if agentsFlags.minVersion != "" {
+				v, err := semver.NewVersion(agentsFlags.minVersion)
+				if err != nil {
+					die("invalid minimum agent version %q: %s", agentsFlags.minVersion, err)
+				}
+				check.MinVersion = v
+			}
+
+			instances, err := client.GetInstances()
+			if err != nil {
+				die("failed to query instances: %s", err)
+			}
+
+			agents, errs := client.ScanAgents(instances, check, agentsFlags.parallel)
+			for id, err := range errs {
+				fmt.Fprintf(os.Stderr, "%s: failed to query service: %s\n", id, err)
+			}
+
+			if agentsFlags.problemsOnly {
+				var unhealthy []clccam.AgentStatus
+
+				for _, a := range agents {
+					if !a.Healthy() {
+						unhealthy = append(unhealthy, a)
+					}
+				}
+				agents = unhealthy
+			}
+			sortAgents(agents, agentsFlags.sortBy)
+
+			if agentsFlags.output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "\t")
+				if err := enc.Encode(agents); err != nil {
+					die("failed to encode agents: %s", err)
+				}
+			} else if len(agents) == 0 {
+				fmt.Println("No agents to report.")
+			} else {
+				printAgents(agents)
+			}
+		},
+	}
+)
+
+func init() {
+	agentsCmd.Flags().DurationVar(&agentsFlags.maxAge, "max-age", 15*time.Minute, "Flag agents that have not pinged within this time")
+	agentsCmd.Flags().StringVar(&agentsFlags.minVersion, "min-version", "", "Flag agents older than this version")
+	agentsCmd.Flags().StringVarP(&agentsFlags.sortBy, "sort", "s", "instance", "Sort by instance|machine|ping|version|state")
+	agentsCmd.Flags().BoolVarP(&agentsFlags.problemsOnly, "problems", "p", false, "List only agents with problems")
+	agentsCmd.Flags().IntVar(&agentsFlags.parallel, "parallel", 4, "Number of concurrent service queries")
+	agentsCmd.Flags().StringVarP(&agentsFlags.output, "output", "o", "table", "Output format (table or json)")
+
+	Root.AddCommand(agentsCmd)
+}
+
+// sortAgents sorts @agents according to @by, then by instance and machine.
+func sortAgents(agents []clccam.AgentStatus, by string) {
+	sort.SliceStable(agents, func(i, j int) bool {
+		var a, b = &agents[i], &agents[j]
+
+		switch by {
+		case "machine":
+			if a.Machine != b.Machine {
+				return a.Machine < b.Machine
+			}
+		case "ping": // oldest ping first
+			if !a.LastPing.Equal(b.LastPing) {
+				return a.LastPing.Before(b.LastPing)
+			}
+		case "version": // oldest version first
+			va, ea := semver.NewVersion(a.AgentVersion)
+			vb, eb := semver.NewVersion(b.AgentVersion)
+			if ea != nil || eb != nil {
+				if (ea == nil) != (eb == nil) {
+					return ea != nil
+				}
+			} else if !va.Equal(vb) {
+				return va.LessThan(vb)
+			}
+		case "state":
+			if a.State != b.State {
+				return a.State < b.State
+			}
+		}
+		if a.InstanceName != b.InstanceName {
+			return a.InstanceName < b.InstanceName
+		} else if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Machine < b.Machine
+	})
+}
+
+// printAgents prints @agents as a table.
+func printAgents(agents []clccam.AgentStatus) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Instance", "Name", "Machine", "State", "Agent", "Last Ping", "Problems"})
+	for _, a := range agents {
+		var (
+			version  = a.AgentVersion
+			lastPing = "never"
+			machine  = a.Machine
+		)
+
+		if version == "" {
+			version = "n/a"
+		}
+		if !a.LastPing.IsZero() {
+			lastPing = humanize.Time(a.LastPing.Local())
+		}
+		if a.Hostname != "" {
+			machine = a.Hostname
+		}
+
+		table.Append([]string{
+			a.Instance,
+			a.InstanceName,
+			machine,
+			a.State.String(),
+			version,
+			lastPing,
+			strings.Join(a.Problems, "; "),
+		})
+	}
+	table.Render()
+}
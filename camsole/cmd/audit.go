@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFlags struct {
+		output   string // Output format
+		parallel int    // Number of concurrent service queries
+		rules    []string
+	}
+
+	// Compliance and hygiene report
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Report policy violations of instances and boxes",
+		Long: `Scans instances and boxes, and reports
+  - machines with public addresses,
+  - instances with automatic updates off,
+  - instances with unmanaged OS,
+  - instances using elastic IPs,
+  - public boxes owned by individuals,
+  - box Password variables holding default values,
+  - instances deployed from outdated box versions.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return checkOutputFormat(auditFlags.output, "table", "json", "html")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := client.Audit(auditFlags.parallel)
+			if err != nil {
+				die("audit failed: %s", err)
+			}
+
+			if len(auditFlags.rules) > 0 {
+				var (
+					selected = make(map[string]bool)
+					findings []clccam.AuditFinding
+				)
+
+				for _, r := range auditFlags.rules {
+					selected[r] = true
+				}
+				for _, f := range report.Findings {
+					if selected[string(f.Rule)] {
+						findings = append(findings, f)
+					}
+				}
+				report.Findings = findings
+			}
+
+			switch auditFlags.output {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "\t")
+				if err := enc.Encode(report); err != nil {
+					die("failed to encode report: %s", err)
+				}
+			case "html":
+				if err := writeAuditHTML(os.Stdout, report); err != nil {
+					die("failed to render report: %s", err)
+				}
+			default:
+				printAudit(report)
+			}
+		},
+	}
+)
+
+func init() {
+	auditCmd.Flags().StringVarP(&auditFlags.output, "output", "o", "table", "Output format (table, json or html)")
+	auditCmd.Flags().IntVar(&auditFlags.parallel, "parallel", 4, "Number of concurrent service queries")
+	auditCmd.Flags().StringSliceVar(&auditFlags.rules, "rule", nil, "Only report these rules (e.g. public-address,default-password)")
+
+	Root.AddCommand(auditCmd)
+}
+
+// printAudit prints @report as a table, followed by a summary.
+func printAudit(report *clccam.AuditReport) {
+	for _, e := range report.Errors {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", e)
+	}
+
+	if len(report.Findings) == 0 {
+		fmt.Printf("No violations found (%d instances, %d boxes).\n", report.Instances, report.Boxes)
+		return
+	}
+
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Severity", "Rule", "Kind", "ID", "Name", "Owner", "Detail"})
+	for _, f := range report.Findings {
+		table.Append([]string{string(f.Severity), string(f.Rule), f.Kind, f.ID, f.Name, f.Owner, f.Detail})
+	}
+	table.Render()
+
+	fmt.Printf("\n%d violations (%d instances, %d boxes scanned):\n", len(report.Findings), report.Instances, report.Boxes)
+	for _, c := range auditRuleCounts(report) {
+		fmt.Printf("  %-20s %d\n", c.Rule, c.Count)
+	}
+}
+
+// auditRuleCount is the number of findings of a rule.
+type auditRuleCount struct {
+	Rule  clccam.AuditRule
+	Count int
+}
+
+// auditRuleCounts returns the number of findings per rule, sorted by rule.
+func auditRuleCounts(report *clccam.AuditReport) (res []auditRuleCount) {
+	for rule, count := range report.Counts() {
+		res = append(res, auditRuleCount{rule, count})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Rule < res[j].Rule
+	})
+	return res
+}
+
+// auditTemplate renders the self-contained HTML report.
+var auditTemplate = template.Must(template.New("audit").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CAM audit report {{.Report.Generated.Format "2006-01-02 15:04 MST"}}</title>
+<style>
+  body  { font-family: sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+  th    { background: #f0f0f0; }
+  .high   { background: #f8d7da; }
+  .medium { background: #fff3cd; }
+  .low    { background: #e2e3e5; }
+  .warn   { color: #a00; }
+</style>
+</head>
+<body>
+<h1>CAM audit report</h1>
+<p>Generated {{.Report.Generated.Format "Mon, 02 Jan 2006 15:04 MST"}}:
+   {{.Report.Instances}} instances and {{.Report.Boxes}} boxes scanned, {{len .Report.Findings}} violations found.</p>
+{{if .Report.Errors}}<h2>Warnings</h2>
+<ul>{{range .Report.Errors}}<li class="warn">{{.}}</li>{{end}}</ul>
+{{end}}{{if .Counts}}<h2>Summary</h2>
+<table>
+<tr><th>Rule</th><th>Violations</th></tr>
+{{range .Counts}}<tr><td>{{.Rule}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Findings</h2>
+<table>
+<tr><th>Severity</th><th>Rule</th><th>Kind</th><th>ID</th><th>Name</th><th>Owner</th><th>Detail</th></tr>
+{{range .Report.Findings}}<tr class="{{.Severity}}"><td>{{.Severity}}</td><td>{{.Rule}}</td><td>{{.Kind}}</td><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Owner}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// writeAuditHTML writes @report as self-contained HTML document to @w.
+func writeAuditHTML(w io.Writer, report *clccam.AuditReport) error {
+	return auditTemplate.Execute(w, struct {
+		Report *clccam.AuditReport
+		Counts []auditRuleCount
+	}{report, auditRuleCounts(report)})
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxCopyFlags struct {
+		owner      string // Owner of the copy
+		url        string // Target endpoint URL
+		token      string // Target endpoint token
+		version    string // Copy this version of the box
+		preserveID bool   // Keep the ID of the source box
+		mapFile    string // Box ID mapping file
+	}
+
+	// boxCopy copies a box to another owner or endpoint
+	boxCopy = &cobra.Command{
+		Use:     "copy  <boxId>",
+		Aliases: []string{"cp"},
+		Short:   "Copy @boxId to another owner or CAM endpoint",
+		Long: `Copies box @boxId, including its files, to the workspace --to-owner. With --to-url and/or
+--to-token, the copy is created on another CAM endpoint.
+
+References to other boxes (services, Box variables) are rewritten using the --map file, which
+maps source box IDs to target box IDs, and which is updated with the ID of the copy. Hence
+copying the leaf boxes first allows to copy composite boxes, and copying again updates the copy.`,
+		PreRunE: checkArgs(1, "Need a box ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var idMap = make(clccam.BoxIDMap)
+			var err error
+
+			if boxCopyFlags.owner == "" {
+				die("need the owner of the copy (--to-owner)")
+			}
+			if boxCopyFlags.mapFile != "" {
+				if idMap, err = clccam.LoadBoxIDMap(boxCopyFlags.mapFile); err != nil {
+					die("%s", err)
+				}
+			}
+
+			target, err := targetClient(boxCopyFlags.url, boxCopyFlags.token)
+			if err != nil {
+				die("%s", err)
+			}
+
+			res, err := client.CopyBox(target, args[0], clccam.CopyBoxOptions{
+				Version:    boxCopyFlags.version,
+				Owner:      boxCopyFlags.owner,
+				PreserveID: boxCopyFlags.preserveID,
+				IDMap:      idMap,
+			})
+			if err != nil {
+				die("%s", err)
+			}
+
+			if boxCopyFlags.mapFile != "" {
+				if err := idMap.Save(boxCopyFlags.mapFile); err != nil {
+					die("%s", err)
+				}
+			}
+			for _, id := range res.Unmapped {
+				fmt.Fprintf(os.Stderr, "WARNING: referenced box %s is not in the box ID map\n", id)
+			}
+
+			if cmd.Flags().Lookup("json").Value.String() != "true" {
+				var action = "Copied"
+
+				if res.Updated {
+					action = "Updated copy of"
+				}
+				fmt.Printf("%s box %s to %s on %s (%d files): %s\n", action, args[0], boxCopyFlags.owner, target.BaseURL(), res.Blobs, res.Box.ID)
+			}
+		},
+	}
+)
+
+func init() {
+	boxCopy.Flags().StringVar(&boxCopyFlags.owner, "to-owner", "", "Owner (workspace) of the copy")
+	boxCopy.Flags().StringVar(&boxCopyFlags.url, "to-url", "", "Endpoint URL of the copy (default: same endpoint)")
+	boxCopy.Flags().StringVar(&boxCopyFlags.token, "to-token", "", "Path or contents of the CAM token for --to-url (default: current token)")
+	boxCopy.Flags().StringVar(&boxCopyFlags.version, "version", "", "Copy this version of @boxId (e.g. 1.2.0)")
+	boxCopy.Flags().BoolVar(&boxCopyFlags.preserveID, "preserve-id", false, "Keep the ID of @boxId (other endpoints only)")
+	boxCopy.Flags().StringVarP(&boxCopyFlags.mapFile, "map", "m", "", "YAML file mapping source to target box IDs")
+
+	cmdBoxes.AddCommand(boxCopy)
+}
+
+// targetClient returns a client for endpoint @url using token @token, or the global client if both are empty.
+func targetClient(url, token string) (*clccam.Client, error) {
+	var camToken clccam.Token
+	var err error
+
+	if url == "" && token == "" {
+		return client, nil
+	} else if url == "" {
+		url = rootFlags.url
+	}
+
+	if token == "" {
+		camToken, err = clccam.LoadToken()
+	} else {
+		camToken, err = tokenFromStringOrFile(token)
+	}
+	if err != nil {
+		return nil, err
+	} else if cl, err := camToken.Claims(); err != nil {
+		return nil, errors.Errorf("target token failed to decode: %s", err)
+	} else if cl.Expired() {
+		return nil, errors.Errorf("target token expired: %s", cl)
+	}
+
+	return camToken.NewClient(
+		clccam.HostURL(url),
+		clccam.InsecureTLS(rootFlags.insecure || strings.HasPrefix(url, "10.")),
+		clccam.Retryer(3, 1*time.Second, rootFlags.timeout),
+		clccam.Context(context.Background()),
+		clccam.Debug(rootFlags.debug),
+		clccam.JsonResponse(rootFlags.json),
+	), nil
+}
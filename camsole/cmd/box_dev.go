@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxDevFlags struct {
+		interval    time.Duration // Polling interval
+		debounce    time.Duration // Quiet period before re-importing
+		owner       string        // Override the box owner
+		instance    string        // Test instance to update after each import
+		reinstall   bool          // Re-install instead of re-configure @instance
+		noLint      bool          // Import even if the box directory has lint errors
+		activityMax time.Duration // Maximum time to stream the activity of @instance
+	}
+
+	// boxDev re-imports a box directory whenever it changes
+	boxDev = &cobra.Command{
+		Use:   "dev  </path/to/box/directory>",
+		Short: "Watch a box directory and re-import it on change",
+		Long: `Imports the box directory as draft, then polls it for changes. Once the directory has
+not changed for --debounce, it is imported again; only files that changed are uploaded.
+
+With --instance, the test instance is re-configured (or re-installed, with --reinstall)
+after each import, and its activity is printed until the operation has completed.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if boxDevFlags.interval <= 0 {
+				return errors.Errorf("invalid --interval %s", boxDevFlags.interval)
+			} else if boxDevFlags.debounce <= 0 {
+				return errors.Errorf("invalid --debounce %s", boxDevFlags.debounce)
+			} else if boxDevFlags.activityMax <= 0 {
+				return errors.Errorf("invalid --activity-timeout %s", boxDevFlags.activityMax)
+			}
+			return checkArgs(1, "Need a box directory")(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				ctx     = signalContext()
+				dir     = args[0]
+				ticker  = time.NewTicker(boxDevFlags.interval)
+				changed time.Time // time of the last change not yet imported
+			)
+			defer ticker.Stop()
+
+			if err := loadBlobCache(); err != nil {
+				die("%s", err)
+			}
+
+			state, err := scanBoxDir(dir)
+			if err != nil {
+				die("%s", err)
+			}
+			devImport(ctx, dir)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+
+				cur, err := scanBoxDir(dir)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+					continue
+				}
+				if files := changedFiles(state, cur); len(files) > 0 {
+					fmt.Printf("%s  changed: %s\n", time.Now().Format("15:04:05"), strings.Join(files, ", "))
+					state, changed = cur, time.Now()
+				} else if !changed.IsZero() && time.Since(changed) >= boxDevFlags.debounce {
+					changed = time.Time{}
+					devImport(ctx, dir)
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	boxDev.Flags().DurationVarP(&boxDevFlags.interval, "interval", "i", time.Second, "Polling interval")
+	boxDev.Flags().DurationVar(&boxDevFlags.debounce, "debounce", 2*time.Second, "Wait until the directory has not changed for this long")
+	boxDev.Flags().StringVarP(&boxDevFlags.owner, "owner", "o", "", "If set, overrides the box owner")
+	boxDev.Flags().StringVar(&boxDevFlags.instance, "instance", "", "Test instance to re-configure after each import")
+	boxDev.Flags().BoolVar(&boxDevFlags.reinstall, "reinstall", false, "Re-install the test instance instead of re-configuring it")
+	boxDev.Flags().BoolVar(&boxDevFlags.noLint, "no-lint", false, "Import even if the box directory has lint errors")
+	boxDev.Flags().DurationVar(&boxDevFlags.activityMax, "activity-timeout", 15*time.Minute, "Maximum time to print the activity of the test instance")
+
+	cmdBoxes.AddCommand(boxDev)
+}
+
+// fileStamp identifies the version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// scanBoxDir returns the stamps of the files in @dir, indexed by relative path.
+// Hidden files and editor backup files are ignored.
+func scanBoxDir(dir string) (map[string]fileStamp, error) {
+	var res = make(map[string]fileStamp)
+
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		} else if rel == "." {
+			return nil
+		}
+
+		if name := fi.Name(); strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".swp") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !fi.IsDir() {
+			res[rel] = fileStamp{fi.ModTime(), fi.Size()}
+		}
+		return nil
+	})
+	return res, errors.Wrapf(err, "failed to scan %s", dir)
+}
+
+// changedFiles returns the sorted paths of files that differ between @old and @cur.
+func changedFiles(old, cur map[string]fileStamp) (res []string) {
+	for p, s := range cur {
+		if o, ok := old[p]; !ok || !o.modTime.Equal(s.modTime) || o.size != s.size {
+			res = append(res, p)
+		}
+	}
+	for p := range old {
+		if _, ok := cur[p]; !ok {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// devImport imports @dir as draft and, if configured, updates the test instance.
+// Errors are printed, since 'box dev' keeps watching until interrupted.
+func devImport(ctx context.Context, dir string) {
+	var start = time.Now()
+
+	box, err := importBox(dir, boxDevFlags.owner, true, false, !boxDevFlags.noLint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s  import failed: %s\n", start.Format("15:04:05"), err)
+		return
+	}
+	fmt.Printf("%s  imported box %s (%s)\n", time.Now().Format("15:04:05"), box.ID, time.Since(start).Round(time.Millisecond))
+	if err := blobCache.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to save blob cache: %s\n", err)
+	}
+
+	if boxDevFlags.instance == "" {
+		return
+	} else if boxDevFlags.reinstall {
+		err = client.ReinstallInstance(boxDevFlags.instance)
+	} else {
+		err = client.ReconfigureInstance(boxDevFlags.instance)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to update instance %s: %s\n", boxDevFlags.instance, err)
+		return
+	}
+	if err := streamActivity(ctx, boxDevFlags.instance, time.Now().Add(-time.Second)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+}
+
+// streamActivity prints the activity of @instanceId created after @since, until the instance
+// has finished processing, the activity timeout expires, or @ctx is cancelled.
+func streamActivity(ctx context.Context, instanceId string, since time.Time) error {
+	var (
+		ticker    = time.NewTicker(boxDevFlags.interval)
+		deadline  = time.Now().Add(boxDevFlags.activityMax)
+		printed   = make(map[string]bool)
+		processed bool // whether the instance was seen processing
+	)
+	defer ticker.Stop()
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		activities, err := client.GetInstanceActivity(instanceId, "")
+		if err != nil {
+			return errors.Wrapf(err, "failed to query activity of %s", instanceId)
+		}
+		sort.SliceStable(activities, func(i, j int) bool {
+			return activities[i].Created.Before(activities[j].Created.Time)
+		})
+		for _, a := range activities {
+			var key = a.Created.String() + a.Machine + a.Text
+
+			if a.Created.Before(since) || printed[key] {
+				continue
+			}
+			printed[key] = true
+			fmt.Printf("%s  %-10s %-12s %s\n", a.Created.Local().Format("15:04:05"), a.Level, a.Event, strings.TrimSpace(a.Text))
+		}
+
+		inst, err := client.GetInstance(instanceId)
+		if err != nil {
+			return errors.Wrapf(err, "failed to query instance %s", instanceId)
+		} else if inst.State == clccam.InstanceState_processing {
+			processed = true
+		} else if processed || time.Since(since) > 30*time.Second {
+			fmt.Printf("%s  instance %s is %s\n", time.Now().Format("15:04:05"), instanceId, inst.State)
+			return nil
+		}
+	}
+	return errors.Errorf("timed out waiting for instance %s", instanceId)
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxDiffFlags struct {
+		version string // Box version to compare against
+	}
+
+	// boxDiff prints differences between boxes
+	boxDiff = &cobra.Command{
+		Use:   "diff  <boxId> [</path/to/box/directory> | <otherBoxId>]",
+		Short: "Print the differences of @boxId",
+		Long: `Compares box @boxId (or its version given by --version) against
+  - a local box directory, showing what 'box import' would change,
+  - another box, or
+  - the draft of @boxId, if only --version is given.
+Without a second argument or --version, compares the latest version of @boxId against its draft.
+
+Exits with status 1 if differences were found.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return errors.Errorf("Need a box ID, and optionally a box directory or other box ID")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				from, to *clccam.BoxSnapshot
+				version  = boxDiffFlags.version
+				err      error
+			)
+
+			if version == "" && len(args) == 1 {
+				if version, err = latestVersion(args[0]); err != nil {
+					die("%s", err)
+				}
+			}
+			if from, err = client.GetBoxSnapshot(args[0], version); err != nil {
+				die("%s", err)
+			}
+
+			if len(args) == 1 {
+				to, err = client.GetBoxSnapshot(args[0], "")
+			} else if fi, statErr := os.Stat(args[1]); statErr == nil && fi.IsDir() {
+				to, err = client.LoadBoxSnapshot(args[1])
+			} else {
+				to, err = client.GetBoxSnapshot(args[1], "")
+			}
+			if err != nil {
+				die("%s", err)
+			}
+
+			diff, err := clccam.DiffBoxes(from, to)
+			if err != nil {
+				die("failed to compare boxes: %s", err)
+			}
+
+			if diff.IsEmpty() {
+				fmt.Printf("No differences between %s and %s.\n", diff.From, diff.To)
+			} else {
+				printBoxDiff(diff)
+			}
+
+			if !diff.IsEmpty() {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	boxDiff.Flags().StringVar(&boxDiffFlags.version, "version", "", "Compare this version of @boxId (e.g. 1.2.0)")
+
+	cmdBoxes.AddCommand(boxDiff)
+}
+
+// latestVersion returns the most recent version of @boxId.
+func latestVersion(boxId string) (string, error) {
+	versions, err := client.GetBoxVersions(boxId)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to query versions of box %s", boxId)
+	} else if v, ok := clccam.LatestBoxVersion(versions); ok {
+		return v.String(), nil
+	}
+	return "", errors.Errorf("box %s has no versions - specify a directory, box or --version to compare against", boxId)
+}
+
+// printBoxDiff prints the field and file differences in @diff.
+func printBoxDiff(diff *clccam.BoxDiff) {
+	fmt.Printf("--- %s\n+++ %s\n", diff.From, diff.To)
+
+	if len(diff.Fields) > 0 {
+		fmt.Printf("\n%s:\n", clccam.BoxFileName)
+		for _, f := range diff.Fields {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+
+	for _, f := range diff.Files {
+		fmt.Println()
+		if f.Binary {
+			fmt.Printf("Binary file %s differs\n", f.Name)
+		} else {
+			fmt.Print(strings.TrimRight(f.Diff, "\n") + "\n")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxExportFlags struct {
+		version string // Box version to export
+	}
+
+	// boxExport writes a box as box directory, the inverse of boxImport.
+	boxExport = &cobra.Command{
+		Use:     "export  <boxId> </path/to/box/directory>",
+		Aliases: []string{"exp", "down", "download"},
+		Short:   "Export box to directory",
+		PreRunE: checkArgs(2, "Need a box ID and a box directory"),
+		Run: func(cmd *cobra.Command, args []string) {
+			box, err := client.ExportBox(args[0], boxExportFlags.version, args[1])
+			if err != nil {
+				die("failed to export box %s: %s", args[0], err)
+			}
+
+			if box.BoxVersion != nil {
+				fmt.Printf("Exported %s version %s (%s) to %s\n", box.Name, box.Version(), box.ID, args[1])
+			} else {
+				fmt.Printf("Exported %s (%s) to %s\n", box.Name, box.ID, args[1])
+			}
+		},
+	}
+)
+
+func init() {
+	boxExport.Flags().StringVar(&boxExportFlags.version, "version", "", "Export this version of the box (e.g. 1.2.0)")
+
+	cmdBoxes.AddCommand(boxExport)
+}
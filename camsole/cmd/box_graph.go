@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/grrtrr/clccam"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxGraphFlags struct {
+		format   string // Output format
+		parallel int    // Number of concurrent requests
+		depth    int    // Maximum depth
+		stack    bool   // Follow the box stack
+		bindings bool   // Follow box bindings
+		claims   bool   // Resolve requirements to claiming boxes
+	}
+
+	// boxGraph prints the dependency graph of a box
+	boxGraph = &cobra.Command{
+		Use:   "graph  <boxId>",
+		Short: "Print the boxes that @boxId refers to",
+		Long: `Resolves the boxes referenced by @boxId recursively, through
+  - its services and Box variables,
+  - boxes claiming its requirements (--claims),
+  - its stack (--stack) and bindings (--bindings),
+and prints the result as tree, Graphviz DOT (e.g. | dot -Tsvg > graph.svg) or JSON.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkArgs(1, "Need a box ID")(cmd, args); err != nil {
+				return err
+			}
+			return checkOutputFormat(boxGraphFlags.format, "tree", "dot", "json")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			g, err := client.ResolveBoxGraph(args[0], clccam.BoxGraphOptions{
+				Parallel: boxGraphFlags.parallel,
+				MaxDepth: boxGraphFlags.depth,
+				Stack:    boxGraphFlags.stack,
+				Bindings: boxGraphFlags.bindings,
+				Claims:   boxGraphFlags.claims,
+			})
+			if err != nil {
+				die("%s", err)
+			}
+
+			switch boxGraphFlags.format {
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "\t")
+				if err := enc.Encode(g); err != nil {
+					die("failed to encode graph: %s", err)
+				}
+			case "dot":
+				writeBoxGraphDot(os.Stdout, g)
+			default:
+				printBoxTree(g, g.Root, "", "", make(map[string]bool), make(map[string]bool))
+				for _, c := range g.Cycles {
+					fmt.Fprintf(os.Stderr, "WARNING: dependency cycle %s\n", strings.Join(c, " -> "))
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	boxGraph.Flags().StringVarP(&boxGraphFlags.format, "format", "f", "tree", "Output format (tree, dot or json)")
+	boxGraph.Flags().IntVar(&boxGraphFlags.parallel, "parallel", 4, "Number of concurrent requests")
+	boxGraph.Flags().IntVarP(&boxGraphFlags.depth, "depth", "d", 0, "Maximum depth to resolve (0 means unlimited)")
+	boxGraph.Flags().BoolVar(&boxGraphFlags.stack, "stack", false, "Follow the box stack")
+	boxGraph.Flags().BoolVar(&boxGraphFlags.bindings, "bindings", false, "Follow box bindings")
+	boxGraph.Flags().BoolVar(&boxGraphFlags.claims, "claims", false, "Resolve requirements to the boxes claiming them")
+
+	cmdBoxes.AddCommand(boxGraph)
+}
+
+// boxNodeLabel returns the display name of @id in @g.
+func boxNodeLabel(g *clccam.BoxGraph, id string) string {
+	if n := g.Nodes[id]; n != nil && n.Name != "" {
+		return fmt.Sprintf("%s (%s)", n.Name, id)
+	}
+	return id
+}
+
+// printBoxTree prints the subtree of @g rooted at @id.
+// @edge:    description of the edge leading to @id
+// @indent:  prefix of the lines below @id
+// @printed: nodes whose subtree was already printed
+// @onPath:  nodes on the path from the root to @id
+func printBoxTree(g *clccam.BoxGraph, id, edge, indent string, printed, onPath map[string]bool) {
+	var line = boxNodeLabel(g, id) + edge
+
+	if n := g.Nodes[id]; n != nil && n.Error != "" {
+		line += " ERROR: " + n.Error
+	}
+
+	switch {
+	case onPath[id]:
+		fmt.Println(line + " (cycle)")
+		return
+	case printed[id]:
+		fmt.Println(line + " (see above)")
+		return
+	}
+	fmt.Println(line)
+	printed[id], onPath[id] = true, true
+	defer delete(onPath, id)
+
+	var children = g.Children(id)
+	for i, e := range children {
+		var branch, next = "├── ", "│   "
+
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+		desc := " [" + string(e.Kind)
+		if e.Label != "" {
+			desc += " " + e.Label
+		}
+		desc += "]"
+
+		fmt.Print(indent + branch)
+		printBoxTree(g, e.To, desc, indent+next, printed, onPath)
+	}
+}
+
+// writeBoxGraphDot writes @g in Graphviz DOT format to @w.
+func writeBoxGraphDot(w io.Writer, g *clccam.BoxGraph) {
+	var styles = map[clccam.BoxEdgeKind]string{
+		clccam.BoxEdgeService:  "solid",
+		clccam.BoxEdgeVariable: "dashed",
+		clccam.BoxEdgeClaim:    "bold",
+		clccam.BoxEdgeStack:    "dotted",
+		clccam.BoxEdgeBinding:  "dotted",
+	}
+
+	fmt.Fprintf(w, "digraph %q {\n\trankdir=LR;\n\tnode [shape=box];\n", g.Root)
+	for _, id := range sortedNodeIDs(g) {
+		var attrs = fmt.Sprintf("label=%q", boxNodeLabel(g, id))
+
+		if id == g.Root {
+			attrs += ", style=filled, fillcolor=lightgrey"
+		} else if g.Nodes[id].Error != "" {
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(w, "\t%q [%s];\n", id, attrs)
+	}
+	for _, e := range g.Edges {
+		var label = string(e.Kind)
+
+		if e.Label != "" {
+			label += ": " + e.Label
+		}
+		fmt.Fprintf(w, "\t%q -> %q [label=%q, style=%s];\n", e.From, e.To, label, styles[e.Kind])
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// sortedNodeIDs returns the IDs of the nodes of @g in sorted order.
+func sortedNodeIDs(g *clccam.BoxGraph) (ids []string) {
+	for id := range g.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
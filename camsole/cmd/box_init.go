@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/grrtrr/clccam"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxInitFlags struct {
+		boxType string   // Box type
+		name    string   // Box name
+		owner   string   // Box owner
+		events  []string // Events to generate stub scripts for
+	}
+
+	// boxInit generates a new box directory
+	boxInit = &cobra.Command{
+		Use:   "init  </path/to/new/box/directory>",
+		Short: "Generate a new box directory",
+		Long: `Generates a box directory that can be imported as is, containing
+  - box.yaml with a new box ID, the schema of --type and sample variables of each type,
+  - stub scripts in events/ (script boxes only),
+  - a readme.MD and the files referenced by box.yaml.`,
+		PreRunE: checkArgs(1, "Need the path of the new box directory"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var s = clccam.BoxScaffold{
+				Name:  boxInitFlags.name,
+				Owner: boxInitFlags.owner,
+			}
+			var err error
+
+			if s.Schema, err = clccam.BoxTypeSchema(boxInitFlags.boxType); err != nil {
+				die("%s", err)
+			}
+
+			for _, e := range boxInitFlags.events {
+				var evt clccam.BoxEvent
+
+				if err := evt.Set(e); err != nil {
+					die("%s", err)
+				}
+				s.Events = append(s.Events, evt)
+			}
+
+			if s.Name == "" {
+				if abs, err := filepath.Abs(args[0]); err != nil {
+					die("%s", err)
+				} else {
+					s.Name = path.Base(abs)
+				}
+			}
+
+			if s.Owner == "" {
+				if s.Owner, err = client.GetTokenSubject(); err != nil {
+					die("unable to determine box owner (use --owner): %s", err)
+				}
+			}
+
+			box, err := s.Create(args[0])
+			if err != nil {
+				die("%s", err)
+			}
+			fmt.Printf("Created %s box %q (%s) in %s.\n", boxInitFlags.boxType, box.Name, box.ID, args[0])
+		},
+	}
+)
+
+func init() {
+	boxInit.Flags().StringVarP(&boxInitFlags.boxType, "type", "t", "script", "Box type (script, policy, cloudformation or composite)")
+	boxInit.Flags().StringVarP(&boxInitFlags.name, "name", "n", "", "Box name (default: name of the directory)")
+	boxInit.Flags().StringVarP(&boxInitFlags.owner, "owner", "o", "", "Box owner (default: owner of the token)")
+	boxInit.Flags().StringSliceVarP(&boxInitFlags.events, "events", "e", []string{"configure", "install", "start", "stop"},
+		"Events to generate stub scripts for (script boxes only)")
+
+	cmdBoxes.AddCommand(boxInit)
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/grrtrr/clccam"
+	"github.com/spf13/cobra"
+)
+
+// boxLint validates a box directory
+var boxLint = &cobra.Command{
+	Use:   "lint  </path/to/box/directory>",
+	Short: "Check a box directory for problems",
+	Long: `Validates a box directory before it is imported:
+  - box.yaml: known schema, no unknown keys, valid variable names, types and values,
+    File variables pointing to existing files, consistent requirements and claims,
+  - events/: valid event names, shebang lines, no CRLF line endings,
+  - icon file type and size, presence of the readme.
+
+Exits with status 1 if errors were found.`,
+	PreRunE: checkArgs(1, "Need a box directory"),
+	Run: func(cmd *cobra.Command, args []string) {
+		var issues = clccam.LintBoxDir(args[0])
+
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+
+		if n := issues.Errors(); n > 0 {
+			fmt.Printf("%d error(s), %d warning(s).\n", n, len(issues)-n)
+			os.Exit(1)
+		} else if len(issues) > 0 {
+			fmt.Printf("%d warning(s).\n", len(issues))
+		} else {
+			fmt.Printf("%s: no problems found.\n", args[0])
+		}
+	},
+}
+
+func init() {
+	cmdBoxes.AddCommand(boxLint)
+}
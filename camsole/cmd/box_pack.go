@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxPackFlags struct {
+		output  string // Archive file
+		version string // Box version to pack (box ID only)
+		noLint  bool   // Pack even if the box directory has lint errors
+	}
+
+	// boxPack creates a box archive
+	boxPack = &cobra.Command{
+		Use:   "pack  </path/to/box/directory> | <boxId>",
+		Short: "Pack a box directory or box into a single archive",
+		Long: `Writes a box directory, or box @boxId (including its files), to a gzip-compressed tar archive
+that contains a manifest with the checksums of the files and the box version.
+The archive can be imported via 'box import box.tgz', e.g. on appliances without network access.`,
+		PreRunE: checkArgs(1, "Need a box directory or box ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := packBox(args[0], boxPackFlags.output); err != nil {
+				die("%s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	boxPack.Flags().StringVarP(&boxPackFlags.output, "output", "o", "box.tgz", "Archive file to write")
+	boxPack.Flags().StringVar(&boxPackFlags.version, "version", "", "Pack this version of @boxId (e.g. 1.2.0)")
+	boxPack.Flags().BoolVar(&boxPackFlags.noLint, "no-lint", false, "Pack even if the box directory has lint errors")
+
+	cmdBoxes.AddCommand(boxPack)
+}
+
+// packBox writes box directory or box ID @src to the archive file @output.
+// A box is exported into a temporary directory first, which is removed before returning.
+func packBox(src, output string) error {
+	var dir = src
+
+	if fi, err := os.Stat(src); err != nil || !fi.IsDir() {
+		tmpDir, err := ioutil.TempDir("", "box-pack-")
+		if err != nil {
+			return errors.Wrapf(err, "failed to create temporary directory")
+		}
+		defer os.RemoveAll(tmpDir)
+
+		if _, err := client.ExportBox(src, boxPackFlags.version, tmpDir); err != nil {
+			return errors.Wrapf(err, "failed to export box %s", src)
+		}
+		dir = tmpDir
+	}
+
+	issues := clccam.LintBoxDir(dir)
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "%s\n", issue)
+	}
+	if n := issues.Errors(); n > 0 && !boxPackFlags.noLint {
+		return errors.Errorf("%s has %d lint error(s) - fix them, or use --no-lint to pack anyway", src, n)
+	}
+	return writeBoxArchive(dir, output)
+}
+
+// writeBoxArchive packs box directory @dir into the archive file @output.
+func writeBoxArchive(dir, output string) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := clccam.PackBoxDir(dir, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	fmt.Printf("Packed box %s (%s", manifest.Name, manifest.Box)
+	if manifest.Version != "" {
+		fmt.Printf(", version %s", manifest.Version)
+	}
+	fmt.Printf(") with %d files into %s.\n", len(manifest.Files), output)
+	return nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/grrtrr/clccam"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxPublishFlags struct {
+		bump    string // Part of the version number to increment
+		version string // Explicit version number
+		message string // Version description
+	}
+
+	// boxPublish creates a new box version from the current draft
+	boxPublish = &cobra.Command{
+		Use:   "publish  <boxId>",
+		Short: "Publish the draft of @boxId as new version",
+		Long: `Creates an immutable version of @boxId from its current draft.
+The version number is either given by --version, or derived from the latest version via --bump.
+It must be greater than the latest existing version of the box.`,
+		PreRunE: checkArgs(1, "Need a box ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var number semver.Version
+
+			if boxPublishFlags.version != "" {
+				v, err := clccam.ParseBoxVersion(boxPublishFlags.version)
+				if err != nil {
+					die("invalid --version: %s", err)
+				}
+				number = v
+			} else if v, err := client.NextBoxVersion(args[0], clccam.VersionBump(boxPublishFlags.bump)); err != nil {
+				die("%s", err)
+			} else {
+				number = v
+			}
+
+			res, err := client.PublishBox(args[0], number, boxPublishFlags.message)
+			if err != nil {
+				die("%s", err)
+			} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+				fmt.Printf("Published version %s of box %s (%s).\n", number, args[0], res.ID)
+			}
+		},
+	}
+)
+
+func init() {
+	boxPublish.Flags().StringVarP(&boxPublishFlags.bump, "bump", "b", "patch", "Part of the latest version to increment (major, minor or patch)")
+	boxPublish.Flags().StringVar(&boxPublishFlags.version, "version", "", "Publish this version number instead (e.g. 1.2.0)")
+	boxPublish.Flags().StringVarP(&boxPublishFlags.message, "message", "m", "", "Description of the new version")
+
+	cmdBoxes.AddCommand(boxPublish)
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxShareFlags struct {
+		role string // Role of the workspace
+	}
+
+	// boxShare shares a box with a workspace
+	boxShare = &cobra.Command{
+		Use:     "share  <boxId> <workspace> [<workspace1> ...]",
+		Short:   "Share @boxId with workspace(s)",
+		Long:    "Adds the workspace(s) as members of @boxId, or updates their role. Invalid member entries are removed.",
+		PreRunE: checkAtLeastArgs(2, "Need a box ID and at least 1 workspace"),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, ws := range args[1:] {
+				if _, err := client.ShareBox(args[0], ws, boxShareFlags.role); err != nil {
+					die("failed to share box %s with %s: %s", args[0], ws, err)
+				} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+					fmt.Printf("Shared box %s with %s (%s).\n", args[0], ws, boxShareFlags.role)
+				}
+			}
+		},
+	}
+
+	// boxUnshare stops sharing a box with a workspace
+	boxUnshare = &cobra.Command{
+		Use:     "unshare  <boxId> <workspace> [<workspace1> ...]",
+		Short:   "Stop sharing @boxId with workspace(s)",
+		PreRunE: checkAtLeastArgs(2, "Need a box ID and at least 1 workspace"),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, ws := range args[1:] {
+				if _, err := client.UnshareBox(args[0], ws); err != nil {
+					die("%s", err)
+				} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+					fmt.Printf("Box %s is no longer shared with %s.\n", args[0], ws)
+				}
+			}
+		},
+	}
+
+	// boxMembers lists the members of a box
+	boxMembers = &cobra.Command{
+		Use:     "members  <boxId>",
+		Aliases: []string{"mem", "shared"},
+		Short:   "List the workspaces that @boxId is shared with",
+		PreRunE: checkArgs(1, "Need a box ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			box, err := client.GetBoxDraft(args[0])
+			if err != nil {
+				die("failed to query box %s: %s", args[0], err)
+			} else if cmd.Flags().Lookup("json").Value.String() == "true" {
+				return
+			}
+
+			valid, invalid, unchecked := client.CleanBoxMembers(box.Members)
+			for _, m := range invalid {
+				fmt.Fprintf(os.Stderr, "WARNING: invalid member %s\n", m)
+			}
+			for _, m := range unchecked {
+				fmt.Fprintf(os.Stderr, "WARNING: member %s\n", m)
+			}
+			printBoxMembers(box.Owner, valid)
+		},
+	}
+)
+
+func init() {
+	boxShare.Flags().StringVarP(&boxShareFlags.role, "role", "r", clccam.BoxRoleViewer, "Role of the workspace (collaborator or viewer)")
+
+	cmdBoxes.AddCommand(boxShare, boxUnshare, boxMembers)
+}
+
+// printBoxMembers prints box @owner and @members as table.
+func printBoxMembers(owner string, members []clccam.WorkSpaceMember) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Workspace", "Role"})
+	table.Append([]string{owner, "owner"})
+	for _, m := range members {
+		table.Append([]string{m.Workspace, m.Role})
+	}
+	table.Render()
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	boxVarFlags struct {
+		varType    string // Variable type
+		value      string // Variable value (path of a local file for File variables)
+		required   bool   // Whether the variable is required
+		visibility string // Variable visibility
+		options    string // Comma-separated options of an Options variable
+		scope      string // Variable scope
+	}
+
+	// boxVar manages box variables
+	boxVar = &cobra.Command{
+		Use:     "var",
+		Aliases: []string{"vars", "variable"},
+		Short:   "Manage the variables of a box",
+	}
+
+	// boxVarList lists box variables
+	boxVarList = &cobra.Command{
+		Use:     "ls  <boxId>",
+		Aliases: []string{"list", "show"},
+		Short:   "List the variables of @boxId",
+		PreRunE: checkArgs(1, "Need a box ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			if box, err := client.GetBoxDraft(args[0]); err != nil {
+				die("failed to query box %s: %s", args[0], err)
+			} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+				printBoxVariables(box.Variables)
+			}
+		},
+	}
+
+	// boxVarSet adds or modifies a box variable
+	boxVarSet = &cobra.Command{
+		Use:   "set  <boxId> <name>",
+		Short: "Add or modify variable @name of @boxId",
+		Long: `Adds variable @name to the draft of @boxId, or modifies it if it already exists.
+When modifying a variable, only the given flags are changed.
+The value of a File variable is the path of a local file, which is uploaded.`,
+		PreRunE: checkArgs(2, "Need a box ID and a variable name"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var boxId, name = args[0], args[1]
+			var v = clccam.BoxVariable{BasicVariable: clccam.BasicVariable{Name: name, Type: "Text"}}
+
+			box, err := client.GetBoxDraft(boxId)
+			if err != nil {
+				die("failed to query box %s: %s", boxId, err)
+			} else if cur := box.Variable(name); cur != nil {
+				v = *cur
+			}
+
+			var flags = cmd.Flags()
+			if flags.Changed("type") {
+				v.Type = boxVarFlags.varType
+			}
+			if flags.Changed("required") {
+				v.Required = boxVarFlags.required
+			}
+			if flags.Changed("options") {
+				v.Options = boxVarFlags.options
+			}
+			if flags.Changed("scope") {
+				v.Scope = boxVarFlags.scope
+			}
+			if flags.Changed("visibility") {
+				if v.Visibility, err = clccam.VisibilityFromString(boxVarFlags.visibility); err != nil {
+					die("invalid visibility %q", boxVarFlags.visibility)
+				}
+			}
+			if flags.Changed("value") {
+				v.Value = boxVarFlags.value
+				if v.Type == "File" && v.Value != "" && !clccam.IsBlobURL(v.Value) {
+					if b, err := ioutil.ReadFile(v.Value); err != nil {
+						die("unable to read File variable %s: %s", name, err)
+					} else if res, err := client.UploadFile(path.Base(v.Value), b); err != nil {
+						die("failed to upload File variable %s: %s", name, err)
+					} else {
+						v.Value = res.Url.String()
+					}
+				}
+			}
+
+			if _, err := client.SetBoxVariable(boxId, v); err != nil {
+				die("%s", err)
+			} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+				fmt.Printf("Set variable %s of box %s.\n", name, boxId)
+			}
+		},
+	}
+
+	// boxVarRemove removes box variables
+	boxVarRemove = &cobra.Command{
+		Use:     "rm  <boxId> <name> [<name1> ...]",
+		Aliases: []string{"del", "delete", "remove"},
+		Short:   "Remove variable(s) from @boxId",
+		PreRunE: checkAtLeastArgs(2, "Need a box ID and at least 1 variable name"),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, name := range args[1:] {
+				if _, err := client.RemoveBoxVariable(args[0], name); err != nil {
+					die("%s", err)
+				} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+					fmt.Printf("Removed variable %s of box %s.\n", name, args[0])
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	boxVarSet.Flags().StringVar(&boxVarFlags.varType, "type", "Text", "Variable type (Text, Password, Port, Number, Options, File, Box or Binding)")
+	boxVarSet.Flags().StringVar(&boxVarFlags.value, "value", "", "Variable value (path of a local file for File variables)")
+	boxVarSet.Flags().BoolVar(&boxVarFlags.required, "required", false, "Whether the variable is required")
+	boxVarSet.Flags().StringVar(&boxVarFlags.visibility, "visibility", "public", "Variable visibility (public, private, internal, ...)")
+	boxVarSet.Flags().StringVar(&boxVarFlags.options, "options", "", "Comma-separated options of an Options variable")
+	boxVarSet.Flags().StringVar(&boxVarFlags.scope, "scope", "", "Variable scope")
+
+	boxVar.AddCommand(boxVarList, boxVarSet, boxVarRemove)
+	cmdBoxes.AddCommand(boxVar)
+}
+
+// printBoxVariables prints @variables as table, hiding Password values.
+func printBoxVariables(variables []clccam.BoxVariable) {
+	if len(variables) == 0 {
+		fmt.Println("No variables.")
+		return
+	}
+
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Name", "Type", "Value", "Required", "Visibility", "Options", "Scope"})
+	for _, v := range variables {
+		var value = v.Value
+
+		if v.Type == "Password" && value != "" {
+			value = "********"
+		}
+		table.Append([]string{v.Name, v.Type, value, fmt.Sprint(v.Required), v.Visibility.String(), v.Options, v.Scope})
+	}
+	table.Render()
+}
@@ -25,15 +25,26 @@ var (
 	}
 
 	// boxList lists one or more boxes
-	boxList = &cobra.Command{
+	boxListFlags clccam.BoxQuery
+	boxList      = &cobra.Command{
 		Use:     "ls  [boxId, ...]",
 		Aliases: []string{"list", "show", "get"},
 		Short:   "List box(es)",
+		Long: `Lists the given boxes, or the boxes of the personal workspace that match all of the
+--category, --owner, --visibility, --schema, --name and --text filters.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return boxListFlags.Validate()
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args) == 0 {
-				if boxes, err := client.GetBoxes(); err != nil {
+				boxes, warnings, err := client.SearchBoxes(boxListFlags)
+				if err != nil {
 					die("failed to query box list: %s", err)
-				} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+				}
+				for _, w := range warnings {
+					fmt.Fprintf(os.Stderr, "WARNING: %s\n", w)
+				}
+				if cmd.Flags().Lookup("json").Value.String() != "true" {
 					listBoxes(boxes)
 				}
 			} else {
@@ -53,19 +64,33 @@ var (
 		AsDraft bool   // Whether to bypass the normal import process
 		Raw     bool   // Whether to use 'raw' import mode
 		Owner   string // Override the box owner
+		NoLint  bool   // Whether to skip linting the box directory
+		NoCache bool   // Whether to upload all files, even if unchanged
 	}
 	boxImport = &cobra.Command{
-		Use:     "import </path/to/box/directory>",
+		Use:     "import </path/to/box/directory> | <box.tgz>",
 		Aliases: []string{"imp", "up", "upload"},
-		Short:   "Import box from directory",
-		PreRunE: checkArgs(1, "Need a box directory"),
+		Short:   "Import box from directory or box archive",
+		Long:    "Imports a box directory, or a box archive created via 'box pack' (verifying its checksums).",
+		PreRunE: checkArgs(1, "Need a box directory or box archive"),
 		Run: func(cmd *cobra.Command, args []string) {
 			var fileVariables []clccam.BasicVariable
 
-			res, err := importBox(args[0], boxImportFlags.Owner, boxImportFlags.AsDraft, boxImportFlags.Raw)
+			if !boxImportFlags.NoCache {
+				if err := loadBlobCache(); err != nil {
+					die("%s", err)
+				}
+			}
+
+			res, err := importBox(args[0], boxImportFlags.Owner, boxImportFlags.AsDraft, boxImportFlags.Raw, !boxImportFlags.NoLint)
 			if err != nil {
 				die("%s", err)
-			} else if cmd.Flags().Lookup("json").Value.String() == "true" {
+			} else if blobCache != nil {
+				if err := blobCache.Save(); err != nil {
+					fmt.Fprintf(os.Stderr, "WARNING: failed to save blob cache: %s\n", err)
+				}
+			}
+			if cmd.Flags().Lookup("json").Value.String() == "true" {
 				return
 			}
 			if res.URI != nil {
@@ -152,19 +177,6 @@ var (
 		},
 	}
 
-	// boxDiff prints differences between boxes
-	boxDiff = &cobra.Command{
-		Use:     "diff  boxId",
-		Short:   "Print the differences of @boxId",
-		PreRunE: checkArgs(1, "Need a box ID"),
-		Run: func(cmd *cobra.Command, args []string) {
-			// NOTE/FIXME: seems to be privileged or not used, getting 405 response; no other documentation.
-			if err := client.WithJsonResponse().GetBoxDiff(args[0]); err != nil {
-				die("failed to query %s box differences: %s", args[0], err)
-			}
-		},
-	}
-
 	// boxBindings prints bindings
 	boxBindings = &cobra.Command{
 		Use:     "bindings  boxId",
@@ -248,38 +260,121 @@ func listBoxes(boxes []clccam.Box) {
 }
 
 func init() {
-	boxImport.Flags().BoolVar(&boxImportFlags.AsDraft, "as-draft", true, "Upload box as draft (non-raw mode only)")
+	boxList.Flags().StringVar(&boxListFlags.Category, "category", "", "Only list boxes of this category (e.g. \"Continuous Integration\")")
+	boxList.Flags().StringVar(&boxListFlags.Owner, "owner", "", "Only list boxes of this owner")
+	boxList.Flags().StringVar(&boxListFlags.Visibility, "visibility", "", "Only list boxes of this visibility (e.g. public)")
+	boxList.Flags().StringVar(&boxListFlags.Schema, "schema", "", "Only list boxes of this type (script, policy, cloudformation, composite) or schema URI")
+	boxList.Flags().StringVar(&boxListFlags.Name, "name", "", "Only list boxes whose name or friendly ID match this pattern (e.g. 'jen*')")
+	boxList.Flags().StringVar(&boxListFlags.Text, "text", "", "Only list boxes containing this text in name, friendly ID, description or readme")
+	boxList.Flags().StringVarP(&boxListFlags.SortBy, "sort", "s", "", "Sort by name, created or updated")
+	boxList.Flags().BoolVar(&boxListFlags.LatestOnly, "latest-only", false, "Only list the latest version of each box")
+	boxList.Flags().IntVar(&boxListFlags.Parallel, "parallel", 4, "Number of concurrent readme downloads (--text)")
+
+	boxImport.Flags().BoolVar(&boxImportFlags.AsDraft, "as-draft", true, "Upload box as draft only; otherwise also publish the next patch version (non-raw mode only)")
 	boxImport.Flags().BoolVar(&boxImportFlags.Raw, "raw", false, "Use raw import mode")
 	boxImport.Flags().StringVarP(&boxImportFlags.Owner, "owner", "o", "", "If set, overrides the box owner")
+	boxImport.Flags().BoolVar(&boxImportFlags.NoLint, "no-lint", false, "Import even if the box directory has lint errors")
+	boxImport.Flags().BoolVar(&boxImportFlags.NoCache, "no-cache", false, "Upload all files, even if unchanged since the last import")
 
-	cmdBoxes.AddCommand(boxList, boxStack, boxVersions, boxDiff, boxBindings, boxImport, boxDelete)
+	cmdBoxes.AddCommand(boxList, boxStack, boxVersions, boxBindings, boxImport, boxDelete)
 	Root.AddCommand(cmdBoxes)
 }
 
-// importBox processes a box directory @boxDir and tries to import this as a box.
+// Name of the file below $CLC_HOME that records uploaded box files (see clccam.BlobCache).
+const blobCacheFile = "blobs.json"
+
+// blobCache, if set, is used by importBox to skip uploading files that have not changed.
+var blobCache *clccam.BlobCache
+
+// loadBlobCache sets blobCache from the cache file below $CLC_HOME, using the entries of the current endpoint.
+func loadBlobCache() (err error) {
+	blobCache, err = clccam.LoadBlobCache(path.Join(clccam.GetClcHome(), blobCacheFile), client.BaseURL())
+	return err
+}
+
+// uploadBlob uploads file @name with content @b, using blobCache if set.
+// A cached upload is only reused if it is still referenced by @current (the box being replaced, may be nil).
+func uploadBlob(current *clccam.Box, name string, b []byte) (clccam.BlobResponse, error) {
+	if blobCache == nil || current == nil {
+		return client.UploadFile(name, b)
+	}
+	res, _, err := client.UploadFileCached(blobCache, name, b, func(cached clccam.BlobResponse) bool {
+		return boxReferencesBlob(current, cached)
+	})
+	return res, err
+}
+
+// boxReferencesBlob returns true if @box refers to the uploaded file @blob.
+// The length is compared where the box records it (events, readme, template).
+func boxReferencesBlob(box *clccam.Box, blob clccam.BlobResponse) bool {
+	var u = blob.Url.String()
+
+	same := func(r clccam.BlobResponse) bool {
+		return r.Url.String() == u && r.Length == blob.Length
+	}
+
+	for _, e := range box.Events {
+		if same(e.BlobResponse) {
+			return true
+		}
+	}
+	if same(box.Readme) || (box.Template != nil && same(*box.Template)) {
+		return true
+	} else if box.Icon == u || (box.IconMetadata != nil && box.IconMetadata.Image.String() == u) {
+		return true
+	}
+	for _, v := range box.Variables {
+		if v.Type == "File" && v.Value == u {
+			return true
+		}
+	}
+	return false
+}
+
+// importBox processes a box directory or box archive @boxDir and tries to import this as a box.
 // @owner:     override box owner
 // @asDraft:   submit box as draft
 // @rawImport: use raw import mode
-func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, error) {
+// @lint:      refuse to import if the box directory has lint errors
+func importBox(boxDir, owner string, asDraft, rawImport, lint bool) (*clccam.Box, error) {
 	var (
 		box        clccam.Box
 		current    *clccam.Box        // Existing variant of this box
 		existingId string             // controls upload: create new or replace
 		uploaderFn = client.UploadBox // determines standard or raw (appliance box) import
+		source     = boxDir           // used in version descriptions
 	)
 
+	if clccam.IsBoxArchive(boxDir) {
+		dir, err := unpackBoxArchive(boxDir)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		boxDir = dir
+	}
+
 	if fi, err := os.Stat(boxDir); err != nil {
 		return nil, err
 	} else if !fi.IsDir() {
 		return nil, errors.Errorf("not a directory: %q", boxDir)
 	}
 
+	if issues := clccam.LintBoxDir(boxDir); len(issues) > 0 {
+		for _, issue := range issues {
+			fmt.Fprintf(os.Stderr, "%s\n", issue)
+		}
+		if n := issues.Errors(); n > 0 && lint {
+			return nil, errors.Errorf("%s has %d lint error(s) - fix them, or use --no-lint to import anyway", source, n)
+		}
+	}
+
 	// Sometimes a 'draft' directory is inserted between the directory and its contents.
-	if _, err := os.Stat(path.Join(boxDir, "draft", "box.yaml")); err == nil {
+	if _, err := os.Stat(path.Join(boxDir, "draft", clccam.BoxFileName)); err == nil {
 		boxDir = path.Join(boxDir, "draft")
 	}
 
-	if content, err := ioutil.ReadFile(path.Join(boxDir, "box.yaml")); err != nil {
+	if content, err := ioutil.ReadFile(path.Join(boxDir, clccam.BoxFileName)); err != nil {
 		return nil, errors.Errorf("unable to read box.yaml: %s", err)
 	} else if err = yaml.Unmarshal(content, &box); err != nil {
 		return nil, errors.Wrapf(err, "failed to deserialize box.yaml")
@@ -294,9 +389,9 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 		uploaderFn = client.UploadApplianceBox
 	}
 
-	// See if it replaces an existing box of the same ID.
+	// See if it replaces an existing box of the same ID. Compare against the draft, which is what gets replaced.
 	if !uuid.Equal(uuid.Nil, box.ID) {
-		if existing, err := client.GetBox(box.ID.String()); err != nil {
+		if existing, err := client.GetBoxDraft(box.ID.String()); err != nil {
 			/* Ignore error here. Call is only used to see if Box already exists. */
 		} else {
 			current = &existing
@@ -313,8 +408,18 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 		// Copy pre-existing configuration.
 		owner = current.Owner
 
-		// Do not copy members, sometimes they contain invalid entries.
-		// box.Members = current.Members
+		// Keep the sharing of the existing box, without the invalid entries it sometimes contains.
+		if len(box.Members) == 0 {
+			box.Members = current.Members
+		}
+		valid, invalid, unchecked := client.CleanBoxMembers(box.Members)
+		for _, m := range invalid {
+			fmt.Fprintf(os.Stderr, "WARNING: dropping box member %s\n", m)
+		}
+		for _, m := range unchecked {
+			fmt.Fprintf(os.Stderr, "WARNING: keeping box member %s\n", m)
+		}
+		box.Members = valid
 
 		if box.Organization == "" {
 			box.Organization = current.Organization
@@ -324,15 +429,17 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 			box.Categories = current.Categories
 		}
 
-		if !asDraft || box.BoxVersion != nil {
-			if current.BoxVersion == nil {
+		// Appliance boxes carry their version; otherwise versions are published from the draft (see below).
+		// GetBox returns the latest version of the box, if it has any.
+		if rawImport && box.BoxVersion != nil {
+			if latest, err := client.GetBox(existingId); err != nil || latest.BoxVersion == nil {
 				box.BoxVersion = &clccam.BoxVersion{
 					Box: box.ID,
 				}
 			} else {
-				box.BoxVersion = current.BoxVersion
+				box.BoxVersion = latest.BoxVersion
 			}
-			box.BoxVersion.Description = "Version created using a kind of ebcli"
+			box.BoxVersion.Description = fmt.Sprintf("Imported from %s", source)
 		}
 	}
 
@@ -376,7 +483,7 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 				}
 				if b, err := ioutil.ReadFile(evtPath); err != nil {
 					return nil, errors.Errorf("unable to read %q event file: %s", evtName, err)
-				} else if res, err := client.UploadFile(evtName, b); err != nil {
+				} else if res, err := uploadBlob(current, evtName, b); err != nil {
 					return nil, errors.Errorf("failed to upload %q event file: %s", evtName, err)
 				} else {
 					box.Events[evt] = clccam.Event{BlobResponse: res}
@@ -390,7 +497,7 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 		if v.Type == "File" && v.Value != "" {
 			if b, err := ioutil.ReadFile(path.Join(boxDir, v.Value)); err != nil {
 				return nil, errors.Errorf("unable to read File variable %s at %s: %s", v.Name, v.Value, err)
-			} else if res, err := client.UploadFile(path.Base(v.Value), b); err != nil {
+			} else if res, err := uploadBlob(current, path.Base(v.Value), b); err != nil {
 				return nil, errors.Errorf("failed to upload File variable %s: %s", v.Name, err)
 			} else {
 				box.Variables[i].Value = res.Url.String()
@@ -406,7 +513,7 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 			//        This is slightly different from the ebcli code.
 			if b, err := ioutil.ReadFile(path.Join(boxDir, p)); err != nil {
 				return nil, errors.Errorf("unable to read icon file %q: %s", p, err)
-			} else if res, err := client.UploadFile(path.Base(p), b); err != nil {
+			} else if res, err := uploadBlob(current, path.Base(p), b); err != nil {
 				return nil, errors.Errorf("failed to upload icon file %q: %s", p, err)
 			} else {
 				box.IconMetadata.Image = res.Url
@@ -415,25 +522,41 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 	} else if box.Icon != "" {
 		if b, err := ioutil.ReadFile(path.Join(boxDir, box.Icon)); err != nil {
 			return nil, errors.Errorf("unable to read icon file %q: %s", box.Icon, err)
-		} else if res, err := client.UploadFile(path.Base(box.Icon), b); err != nil {
+		} else if res, err := uploadBlob(current, path.Base(box.Icon), b); err != nil {
 			return nil, errors.Errorf("failed to upload icon file %q: %s", box.Icon, err)
 		} else {
 			box.Icon = res.Url.String()
 		}
 	}
 
+	// Template file (e.g. CloudFormation), unless it refers to an already uploaded file.
+	if box.Template != nil && !box.Template.Url.IsZero() && !clccam.IsBlobURL(box.Template.Url.String()) {
+		var p = box.Template.Url.Path
+
+		if b, err := ioutil.ReadFile(path.Join(boxDir, p)); err != nil {
+			return nil, errors.Errorf("unable to read template file %q: %s", p, err)
+		} else if res, err := uploadBlob(current, path.Base(p), b); err != nil {
+			return nil, errors.Errorf("failed to upload template file %q: %s", p, err)
+		} else {
+			box.Template = &res
+		}
+	}
+
 	// readme.MD file
 	if _, err := os.Stat(path.Join(boxDir, clccam.ReadmeName)); err == nil {
 		if b, err := ioutil.ReadFile(path.Join(boxDir, clccam.ReadmeName)); err != nil {
 			return nil, errors.Errorf("unable to read 'read-me' file: %s", err)
-		} else if box.Readme, err = client.UploadFile(clccam.ReadmeName, b); err != nil {
+		} else if box.Readme, err = uploadBlob(current, clccam.ReadmeName, b); err != nil {
 			return nil, errors.Errorf("failed to upload readme file: %s", err)
 		}
 	}
 
 	// Upload
+	if !rawImport {
+		// A box.yaml exported from a box version still refers to that version: upload it as draft.
+		box.BoxVersion = nil
+	}
 	if box.BoxVersion != nil {
-		fmt.Println("WARNING: box version handling is not fully functional yet")
 		if !uuid.Equal(box.BoxVersion.Box, box.ID) {
 			return uploaderFn(&box, box.BoxVersion.Box.String())
 		}
@@ -441,5 +564,37 @@ func importBox(boxDir, owner string, asDraft, rawImport bool) (*clccam.Box, erro
 		box.Created = clccam.Timestamp{Time: time.Now().UTC()}
 	}
 
-	return uploaderFn(&box, existingId)
+	res, err := uploaderFn(&box, existingId)
+	if err != nil || asDraft || rawImport {
+		return res, err
+	}
+
+	// Not a draft: publish the uploaded draft as the next patch version.
+	number, err := client.NextBoxVersion(res.ID.String(), clccam.BumpPatch)
+	if err != nil {
+		return nil, err
+	}
+	return client.PublishBox(res.ID.String(), number, fmt.Sprintf("Imported from %s", source))
+}
+
+// unpackBoxArchive extracts the box archive @file into a temporary directory, which the caller must remove.
+func unpackBoxArchive(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	dir, err := ioutil.TempDir("", "box-import-")
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create temporary directory")
+	}
+
+	manifest, err := clccam.UnpackBoxArchive(f, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrapf(err, "invalid box archive %s", file)
+	}
+	fmt.Fprintf(os.Stderr, "Unpacked box %s (%s) with %d files from %s.\n", manifest.Name, manifest.Box, len(manifest.Files), file)
+	return dir, nil
 }
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	explainFlags struct {
+		lines     int  // Log lines of context around the failure
+		preceding int  // Number of preceding activities to show
+		noScript  bool // Whether to omit the event script contents
+	}
+
+	// Consolidated failure report of an instance
+	instanceExplain = &cobra.Command{
+		Use:     "explain  <instanceId>",
+		Aliases: []string{"why", "diagnose"},
+		Short:   "Explain why an instance deployment failed",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if explainFlags.lines < 0 {
+				return errors.Errorf("invalid number of log lines %d", explainFlags.lines)
+			} else if explainFlags.preceding < 0 {
+				return errors.Errorf("invalid number of preceding activities %d", explainFlags.preceding)
+			}
+			return checkArgs(1, "Need an instance ID")(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := client.ExplainInstanceFailure(args[0], explainFlags.lines, explainFlags.preceding)
+			if err != nil {
+				die("%s", err)
+			} else if cmd.Flags().Lookup("json").Value.String() == "true" {
+				return
+			}
+
+			var a = report.Activity
+
+			fmt.Printf("Instance %s (%s) is %s.\n", report.Instance.Name, report.Instance.ID, report.Instance.State)
+			if op := report.Operation; op != nil {
+				fmt.Printf("Operation %s by %s on %s => %s.\n", op.Operation, op.Username,
+					op.Created.Time.Local().Format("_2 Jan 15:04 MST"), op.State)
+			}
+
+			fmt.Printf("\nFailed activity:\n")
+			fmt.Printf("  Time:      %s\n", a.Created.Time.Local().Format("_2 Jan 15:04:05.0 MST"))
+			fmt.Printf("  Machine:   %s\n", a.Machine)
+			fmt.Printf("  Box:       %s\n", a.Box)
+			fmt.Printf("  Event:     %s\n", a.Event)
+			fmt.Printf("  Level:     %s\n", a.Level)
+			fmt.Printf("  Exit code: %d\n", a.ExitCode)
+			fmt.Printf("  Text:      %s\n", a.Text)
+
+			if len(report.Preceding) > 0 {
+				fmt.Printf("\nPreceding activities on %s:\n", a.Machine)
+				printActivities(report.Preceding)
+			}
+
+			if !report.ScriptURL.IsZero() {
+				fmt.Printf("\nEvent script %s:\n", report.ScriptURL)
+				if report.Script != "" && !explainFlags.noScript {
+					printIndented(strings.Split(strings.TrimRight(report.Script, "\n"), "\n"), 1)
+				}
+			}
+
+			if len(report.LogExcerpt) > 0 {
+				fmt.Printf("\nMachine log excerpt (%s, from line %d):\n", a.Machine, report.LogStart)
+				printIndented(report.LogExcerpt, report.LogStart)
+			}
+
+			for _, w := range report.Warnings {
+				fmt.Printf("\nWARNING: %s\n", w)
+			}
+		},
+	}
+)
+
+func init() {
+	instanceExplain.Flags().IntVarP(&explainFlags.lines, "lines", "n", 20, "Log lines of context before and after the failure")
+	instanceExplain.Flags().IntVar(&explainFlags.preceding, "preceding", 10, "Number of preceding activities to show")
+	instanceExplain.Flags().BoolVar(&explainFlags.noScript, "no-script", false, "Do not print the event script contents")
+
+	cmdInstances.AddCommand(instanceExplain)
+}
+
+// printIndented prints @lines with line numbers starting at @start.
+func printIndented(lines []string, start int) {
+	var width = len(fmt.Sprint(start + len(lines)))
+
+	for i, line := range lines {
+		fmt.Printf("  %*d  %s\n", width, start+i, line)
+	}
+}
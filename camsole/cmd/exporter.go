@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exporterFlags struct {
+		listen     string        // Address to serve /metrics on
+		interval   time.Duration // Collection interval
+		parallel   int           // Number of concurrent per-instance queries
+		operations bool          // Whether to collect instance operations
+	}
+
+	// Prometheus metrics exporter
+	exporterCmd = &cobra.Command{
+		Use:   "exporter",
+		Short: "Serve CAM metrics in Prometheus text format",
+		Long: `Periodically collects instances, services, operations and providers, and serves
+the resulting metrics on /metrics in the Prometheus text exposition format.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				ctx = signalContext()
+				e   = &exporter{api: clccam.NewAPIMetrics()}
+				mux = http.NewServeMux()
+				srv = &http.Server{Addr: exporterFlags.listen, Handler: mux}
+			)
+
+			// Applied after the Retryer, so that each API call is counted once.
+			client.With(clccam.Metrics(e.api))
+
+			mux.HandleFunc("/metrics", e.serveMetrics)
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprintln(w, `<html><body><a href="/metrics">Metrics</a></body></html>`)
+			})
+
+			go e.run(ctx, exporterFlags.interval)
+			go func() {
+				<-ctx.Done()
+				srv.Shutdown(context.Background())
+			}()
+
+			fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", exporterFlags.listen)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				die("%s", err)
+			}
+		},
+	}
+)
+
+func init() {
+	exporterCmd.Flags().StringVarP(&exporterFlags.listen, "listen", "l", ":9500", "Address to serve /metrics on")
+	exporterCmd.Flags().DurationVarP(&exporterFlags.interval, "interval", "i", time.Minute, "Collection interval")
+	exporterCmd.Flags().IntVar(&exporterFlags.parallel, "parallel", 4, "Number of concurrent per-instance queries")
+	exporterCmd.Flags().BoolVar(&exporterFlags.operations, "operations", true, "Collect instance operations (one API call per instance)")
+
+	Root.AddCommand(exporterCmd)
+}
+
+// exporter periodically collects CAM metrics and serves the latest snapshot.
+type exporter struct {
+	// API call metrics, recorded by the client transport
+	api *clccam.APIMetrics
+
+	mu          sync.Mutex
+	snapshot    []byte        // metrics of the last successful collection
+	lastSuccess time.Time     // time of the last successful collection
+	lastRun     time.Duration // duration of the last collection
+	errors      uint64        // number of failed collections
+	partial     uint64        // number of per-instance/provider queries that failed
+}
+
+// run collects metrics every @interval until @ctx is cancelled.
+func (e *exporter) run(ctx context.Context, interval time.Duration) {
+	for {
+		var start = time.Now()
+
+		snapshot, partial, err := collectMetrics()
+
+		e.mu.Lock()
+		e.lastRun = time.Since(start)
+		e.partial += uint64(partial)
+		if err != nil {
+			e.errors++
+			fmt.Fprintf(os.Stderr, "%s: collection failed: %s\n", start.Format("_2 Jan 15:04:05"), err)
+		} else {
+			e.snapshot, e.lastSuccess = snapshot, start
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// serveMetrics serves the latest snapshot, followed by the exporter and API call metrics.
+func (e *exporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+
+	e.mu.Lock()
+	buf.Write(e.snapshot)
+	var up, lastSuccess float64
+	if !e.lastSuccess.IsZero() {
+		up, lastSuccess = 1, float64(e.lastSuccess.Unix())
+	}
+	clccam.WriteMetric(&buf, "cam_up", "Whether a collection has succeeded.", "gauge", clccam.MetricSample{Value: up})
+	clccam.WriteMetric(&buf, "cam_exporter_last_success_timestamp_seconds", "Time of the last successful collection.", "gauge",
+		clccam.MetricSample{Value: lastSuccess})
+	clccam.WriteMetric(&buf, "cam_exporter_collect_duration_seconds", "Duration of the last collection.", "gauge",
+		clccam.MetricSample{Value: e.lastRun.Seconds()})
+	clccam.WriteMetric(&buf, "cam_exporter_collect_errors_total", "Number of failed collections.", "counter",
+		clccam.MetricSample{Value: float64(e.errors)})
+	clccam.WriteMetric(&buf, "cam_exporter_partial_errors_total", "Number of per-instance or provider queries that failed.", "counter",
+		clccam.MetricSample{Value: float64(e.partial)})
+	e.mu.Unlock()
+
+	e.api.WriteMetrics(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// collectMetrics queries CAM and renders the resulting metrics.
+// Returns the number of secondary queries that failed; fails only if the instance list can not be retrieved.
+func collectMetrics() (snapshot []byte, partial int, err error) {
+	var (
+		buf    bytes.Buffer
+		now    = time.Now()
+		active []clccam.Instance
+		ids    []string
+	)
+
+	instances, err := client.GetInstances()
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "failed to query instances")
+	}
+	for _, inst := range instances {
+		if !inst.IsTerminated() {
+			active = append(active, inst)
+			ids = append(ids, inst.ID)
+		}
+	}
+
+	// 1. Instances
+	var (
+		counts = make(map[string]float64)
+		prices = make(map[string]float64)
+	)
+	for i := range active {
+		var (
+			inst = &active[i]
+			key  = strings.Join([]string{inst.State.String(), inst.Operation.Event.String(), inst.Owner, instanceBoxName(inst)}, "\x00")
+		)
+
+		counts[key]++
+		if inst.PoweredOn() {
+			prices[inst.Owner] += instanceHourlyPrice(inst)
+		}
+	}
+	clccam.WriteMetric(&buf, "cam_instances", "Number of instances, by state, last operation, owner and box.", "gauge",
+		keyedSamples(counts, "state", "operation", "owner", "box")...)
+	clccam.WriteMetric(&buf, "cam_instances_hourly_price", "Sum of the hourly price of running instances, by owner.", "gauge",
+		keyedSamples(prices, "owner")...)
+
+	// 2. Machine agents
+	agents, errs := client.ScanAgents(active, clccam.AgentCheck{}, exporterFlags.parallel)
+	partial += len(errs)
+
+	var pings []clccam.MetricSample
+	for _, a := range agents {
+		if !a.LastPing.IsZero() {
+			pings = append(pings, clccam.MetricSample{
+				Labels: []string{"instance", a.Instance, "name", a.InstanceName, "machine", a.Machine, "state", a.State.String()},
+				Value:  a.PingAge.Seconds(),
+			})
+		}
+	}
+	clccam.WriteMetric(&buf, "cam_machine_agent_ping_age_seconds", "Time since the last ping of the machine agent.", "gauge", pings...)
+
+	// 3. Operations
+	if exporterFlags.operations {
+		var (
+			sums, totals = make(map[string]float64), make(map[string]float64)
+			last         []clccam.MetricSample
+		)
+
+		operations, errs := client.GetAllInstanceOperations(ids, exporterFlags.parallel)
+		partial += len(errs)
+
+		for i := range active {
+			var latest *clccam.InstanceOperation
+
+			ops := operations[active[i].ID]
+			for j := range ops {
+				var (
+					op  = &ops[j]
+					key = op.Operation.String() + "\x00" + op.State.String()
+				)
+
+				if op.State != clccam.InstanceState_processing {
+					sums[key] += op.Updated.Time.Sub(op.Created.Time).Seconds()
+					totals[key]++
+				}
+				if latest == nil || op.Created.Time.After(latest.Created.Time) {
+					latest = op
+				}
+			}
+
+			if latest != nil {
+				var end = latest.Updated.Time
+
+				if latest.State == clccam.InstanceState_processing {
+					end = now
+				}
+				last = append(last, clccam.MetricSample{
+					Labels: []string{"instance", active[i].ID, "name", active[i].Name,
+						"operation", latest.Operation.String(), "state", latest.State.String()},
+					Value: end.Sub(latest.Created.Time).Seconds(),
+				})
+			}
+		}
+
+		clccam.WriteMetric(&buf, "cam_instance_last_operation_duration_seconds",
+			"Duration of the most recent operation of each instance (so far, if still processing).", "gauge", last...)
+		clccam.WriteSummary(&buf, "cam_operation_duration_seconds", "Duration of completed instance operations.",
+			keyedSamples(sums, "operation", "state"), keyedSamples(totals, "operation", "state"))
+	}
+
+	// 4. Providers
+	if providers, err := client.GetProviders(); err != nil {
+		partial++
+	} else {
+		var counts = make(map[string]float64)
+
+		for _, p := range providers {
+			counts[p.Type+"\x00"+p.State]++
+		}
+		clccam.WriteMetric(&buf, "cam_providers", "Number of provider accounts, by type and state.", "gauge",
+			keyedSamples(counts, "type", "state")...)
+	}
+	return buf.Bytes(), partial, nil
+}
+
+// instanceBoxName returns the name of the main box of @inst, or its ID if the name is not known.
+func instanceBoxName(inst *clccam.Instance) string {
+	for _, b := range inst.Boxes {
+		if uuid.Equal(b.ID, inst.Box) && b.Name != "" {
+			return b.Name
+		}
+	}
+	return inst.Box.String()
+}
+
+// instanceHourlyPrice returns the current hourly price of @inst, based on its pricing history.
+func instanceHourlyPrice(inst *clccam.Instance) float64 {
+	var (
+		price  float64
+		latest time.Time
+	)
+
+	for _, p := range inst.PricingHistory {
+		if p.PricingInfo.Factor > 0 && !p.From.Time.Before(latest) {
+			price = float64(p.PricingInfo.HourlyPrice) / float64(p.PricingInfo.Factor)
+			latest = p.From.Time
+		}
+	}
+	return price
+}
+
+// keyedSamples converts @values, keyed by NUL-separated label values, into samples with label @names.
+func keyedSamples(values map[string]float64, names ...string) (res []clccam.MetricSample) {
+	var keys []string
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var labels []string
+
+		for i, v := range strings.Split(key, "\x00") {
+			if i < len(names) {
+				labels = append(labels, names[i], v)
+			}
+		}
+		res = append(res, clccam.MetricSample{Labels: labels, Value: values[key]})
+	}
+	return res
+}
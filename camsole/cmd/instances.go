@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -203,7 +204,7 @@ var (
 
 	// Retrieve machine logs
 	instanceGetLogs = &cobra.Command{
-		Use:     "logs  <instanceId> [<machineId>]",
+		Use:     "logs  <instanceId> [<machineId>] | --all --out <dir> <instanceId> [<instanceId1> ...]",
 		Aliases: []string{"log", "l"},
 		Short:   "Retrieve VM log output",
 		PreRunE: checkAtLeastArgs(1, "Need an instance ID and optionally a machine ID"),
@@ -211,7 +212,27 @@ var (
 			var (
 				instanceId = args[0]
 				machine    string
+				re         *regexp.Regexp
+				err        error
 			)
+
+			if logsFlags.grep != "" {
+				if re, err = regexp.Compile(logsFlags.grep); err != nil {
+					die("invalid --grep expression %q: %s", logsFlags.grep, err)
+				}
+			}
+
+			if logsFlags.all {
+				if logsFlags.out == "" {
+					die("--all requires an output directory (--out)")
+				} else if n := downloadMachineLogs(args, logsFlags.out, re, logsFlags.gzip, logsFlags.parallel); n > 0 {
+					die("failed to retrieve %d log(s)", n)
+				}
+				return
+			} else if len(args) > 2 {
+				die("Need an instance ID and optionally a machine ID (use --all for multiple instances)")
+			}
+
 			if len(args) == 2 {
 				machine = args[1]
 			} else {
@@ -220,7 +241,7 @@ var (
 				} else if m := instance.Service.Machines; len(m) == 0 {
 					fmt.Println("No machines available.")
 				} else if len(m) > 1 {
-					die("unable to retrieve logs: %s has more than 1 machine", instanceId)
+					die("unable to retrieve logs: %s has more than 1 machine (use --all)", instanceId)
 				} else {
 					machine = m[0].Name
 				}
@@ -228,7 +249,7 @@ var (
 			if logs, err := client.GetInstanceMachineLogs(instanceId, machine); err != nil {
 				die("failed to query instance %s activities: %s", instanceId, err)
 			} else if cmd.Flags().Lookup("json").Value.String() == "true" {
-			} else if len(logs) == 0 {
+			} else if logs = filterLogLines(logs, re); len(logs) == 0 {
 				fmt.Println("No log information.")
 			} else {
 				fmt.Println(logs)
@@ -415,6 +436,11 @@ func init() {
 	// Flags
 	instanceGetActivity.Flags().String("op", "", "Filter by operation (optional)")
 	instanceTerminate.Flags().BoolP("force", "f", false, "Whether to force-terminate the instance")
+	instanceGetLogs.Flags().BoolVarP(&logsFlags.all, "all", "a", false, "Retrieve the logs of all machines of the given instance(s)")
+	instanceGetLogs.Flags().StringVarP(&logsFlags.out, "out", "o", "", "Output directory for --all, logs are written to <dir>/<instance>/<machine>.log")
+	instanceGetLogs.Flags().StringVar(&logsFlags.grep, "grep", "", "Only retain log lines matching this regular expression")
+	instanceGetLogs.Flags().BoolVarP(&logsFlags.gzip, "gzip", "z", false, "Write gzip-compressed log files (--all only)")
+	instanceGetLogs.Flags().IntVar(&logsFlags.parallel, "parallel", 4, "Maximum number of concurrent downloads (--all only)")
 
 	cmdInstances.AddCommand(instanceGet,
 		instanceGetService, instanceGetActivity, instanceGetOps, instanceGetLogs, instanceGetBindings,
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// logsFlags are used by the instance 'logs' command.
+var logsFlags struct {
+	all      bool   // Fetch the logs of all machines of all given instances
+	out      string // Output directory for --all
+	grep     string // Regular expression that log lines have to match
+	gzip     bool   // Whether to write gzip-compressed log files
+	parallel int    // Maximum number of concurrent downloads
+}
+
+// machineLogResult records the outcome of fetching the logs of a single machine.
+type machineLogResult struct {
+	instance string // Instance ID
+	machine  string // Machine name, empty if the instance has no machines
+	file     string // Output file, if written
+	lines    int    // Number of lines written
+	err      error  // Error, if failed
+}
+
+// filterLogLines returns the lines of @logs matching @re, or @logs unchanged if @re is nil.
+func filterLogLines(logs string, re *regexp.Regexp) string {
+	var res []string
+
+	if re == nil {
+		return logs
+	}
+	for _, line := range strings.Split(logs, "\n") {
+		if re.MatchString(line) {
+			res = append(res, line)
+		}
+	}
+	return strings.Join(res, "\n")
+}
+
+// downloadMachineLogs fetches the logs of all machines of @instanceIds concurrently, writing them
+// to @outDir/<instance>/<machine>.log[.gz]. It prints a summary and returns the number of failures.
+func downloadMachineLogs(instanceIds []string, outDir string, re *regexp.Regexp, compress bool, parallel int) (failures int) {
+	var (
+		results []machineLogResult
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	var sem = make(chan struct{}, parallel) // limits the number of concurrent downloads
+
+	addResult := func(r machineLogResult) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	}
+
+	for _, instanceId := range instanceIds {
+		instance, err := client.GetInstance(instanceId)
+		if err != nil {
+			addResult(machineLogResult{instance: instanceId, err: errors.Wrapf(err, "failed to query machines")})
+			continue
+		} else if len(instance.Service.Machines) == 0 {
+			addResult(machineLogResult{instance: instanceId, err: errors.Errorf("instance has no machines")})
+			continue
+		}
+
+		for _, m := range instance.Service.Machines {
+			wg.Add(1)
+			go func(instanceId, machine string) {
+				defer wg.Done()
+
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				addResult(writeMachineLogs(instanceId, machine, outDir, re, compress))
+			}(instanceId, m.Name)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].instance == results[j].instance {
+			return results[i].machine < results[j].machine
+		}
+		return results[i].instance < results[j].instance
+	})
+
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Instance", "Machine", "Lines", "Result"})
+	for _, r := range results {
+		var result = r.file
+
+		if r.err == nil && r.file == "" {
+			result = "no matching lines"
+		} else if r.err != nil {
+			result = fmt.Sprintf("FAILED: %s", r.err)
+			failures++
+		}
+		table.Append([]string{r.instance, r.machine, fmt.Sprint(r.lines), result})
+	}
+	table.Render()
+	return failures
+}
+
+// writeMachineLogs fetches the logs of @machine on @instanceId and writes them below @outDir.
+func writeMachineLogs(instanceId, machine, outDir string, re *regexp.Regexp, compress bool) machineLogResult {
+	var (
+		res      = machineLogResult{instance: instanceId, machine: machine}
+		fileName = path.Join(outDir, instanceId, machine+".log")
+		w        io.Writer
+	)
+
+	logs, err := client.GetInstanceMachineLogs(instanceId, machine)
+	if err != nil {
+		res.err = err
+		return res
+	} else if len(logs) == 0 {
+		res.err = errors.Errorf("no log output")
+		return res
+	} else if logs = filterLogLines(logs, re); len(logs) == 0 {
+		return res // no matching lines
+	}
+
+	if err := os.MkdirAll(path.Dir(fileName), 0755); err != nil {
+		res.err = err
+		return res
+	}
+
+	if compress {
+		fileName += ".gz"
+	}
+	fd, err := os.Create(fileName)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer fd.Close()
+
+	var bw = bufio.NewWriter(fd)
+	var gz *gzip.Writer
+
+	if w = bw; compress {
+		gz = gzip.NewWriter(bw)
+		w = gz
+	}
+
+	if _, err := io.WriteString(w, strings.TrimRight(logs, "\n")+"\n"); err != nil {
+		res.err = errors.Wrapf(err, "failed to write %s", fileName)
+		return res
+	} else if gz != nil && gz.Close() != nil {
+		res.err = errors.Errorf("failed to compress %s", fileName)
+		return res
+	} else if err := bw.Flush(); err != nil {
+		res.err = errors.Wrapf(err, "failed to write %s", fileName)
+		return res
+	}
+	res.file, res.lines = fileName, strings.Count(strings.TrimRight(logs, "\n"), "\n")+1
+	return res
+}
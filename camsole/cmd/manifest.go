@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	manifestFlags struct {
+		file     string        // Path to the manifest file
+		prune    bool          // Whether to terminate managed instances not in the manifest
+		dryRun   bool          // Print the plan only
+		wait     bool          // Wait for each instance to settle before the next action
+		interval time.Duration // Polling interval when waiting
+	}
+
+	// Print the actions needed to reconcile the manifest with the actual instances
+	manifestPlan = &cobra.Command{
+		Use:   "plan  -f <manifest.yaml>",
+		Short: "Show the changes needed to apply an instance manifest",
+		Run: func(cmd *cobra.Command, args []string) {
+			if plan := loadManifestPlan(); len(plan) == 0 {
+				fmt.Println("No changes - instances are up to date.")
+			} else {
+				printPlan(plan)
+			}
+		},
+	}
+
+	// Reconcile the manifest with the actual instances
+	manifestApply = &cobra.Command{
+		Use:   "apply  -f <manifest.yaml>",
+		Short: "Apply an instance manifest",
+		Run: func(cmd *cobra.Command, args []string) {
+			var plan = loadManifestPlan()
+
+			if len(plan) == 0 {
+				fmt.Println("No changes - instances are up to date.")
+				return
+			}
+			printPlan(plan)
+
+			if manifestFlags.dryRun {
+				fmt.Println("Dry run - no changes made.")
+				return
+			}
+
+			for _, action := range plan {
+				fmt.Printf("%s %s ...\n", action.Type, action.Name)
+
+				instanceId, err := client.ApplyPlanAction(action)
+				if err != nil {
+					die("failed to %s %s: %s", action.Type, action.Name, err)
+				}
+
+				if manifestFlags.wait && instanceId != "" {
+					// Give the server time to register the operation before polling the instance state.
+					time.Sleep(manifestFlags.interval)
+
+					if inst, err := client.WaitForInstance(instanceId, manifestFlags.interval); err != nil {
+						die("failed to wait for %s: %s", instanceId, err)
+					} else if inst.State == clccam.InstanceState_unavailable {
+						die("%s %s (%s) failed: instance is %s", action.Type, action.Name, instanceId, inst.State)
+					}
+				}
+			}
+			fmt.Printf("Applied %d change(s).\n", len(plan))
+		},
+	}
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{manifestPlan, manifestApply} {
+		cmd.Flags().StringVarP(&manifestFlags.file, "file", "f", "", "Path to the instance manifest")
+		cmd.Flags().BoolVar(&manifestFlags.prune, "prune", false, "Terminate managed instances that are not in the manifest")
+		cmd.MarkFlagRequired("file")
+	}
+	manifestApply.Flags().BoolVarP(&manifestFlags.dryRun, "dry-run", "n", false, "Print the plan without making changes")
+	manifestApply.Flags().BoolVarP(&manifestFlags.wait, "wait", "w", true, "Wait for each instance operation to complete")
+	manifestApply.Flags().DurationVar(&manifestFlags.interval, "interval", 15*time.Second, "Polling interval while waiting")
+
+	Root.AddCommand(manifestPlan, manifestApply)
+}
+
+// loadManifestPlan loads the manifest and computes the plan for it.
+func loadManifestPlan() []clccam.PlanAction {
+	m, err := clccam.LoadManifest(manifestFlags.file)
+	if err != nil {
+		die("%s", err)
+	}
+
+	plan, err := client.PlanManifest(m, manifestFlags.prune)
+	if err != nil {
+		die("failed to plan %s: %s", manifestFlags.file, err)
+	}
+	return plan
+}
+
+// printPlan prints the actions of @plan in tabulated form.
+func printPlan(plan []clccam.PlanAction) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Action", "Name", "ID", "Changes"})
+	for _, a := range plan {
+		var id = "(new)"
+
+		if a.Instance != nil {
+			id = a.Instance.ID
+		}
+		if len(a.Changes) == 0 {
+			table.Append([]string{string(a.Type), a.Name, id, ""})
+		}
+		for i, change := range a.Changes {
+			if i == 0 {
+				table.Append([]string{string(a.Type), a.Name, id, change})
+			} else {
+				table.Append([]string{"", "", "", change})
+			}
+		}
+	}
+	table.Render()
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Top-level migration command
+	cmdMigrate = &cobra.Command{
+		Use:     "migrate",
+		Aliases: []string{"mig", "migration"},
+		Short:   "Migrate instances",
+	}
+
+	migrateFlags struct {
+		force     bool          // Whether to skip the prerequisite checks
+		wait      bool          // Whether to wait for a single stage to complete
+		interval  time.Duration // Polling interval while waiting for a stage to complete
+		retry     bool          // Whether to automatically retry a failed stage
+		noTest    bool          // Whether to skip the test-failover stage
+		noCleanup bool          // Whether to skip the cleanup stage
+	}
+
+	// Print the per-stage migration status
+	migrateStatus = &cobra.Command{
+		Use:     "status  <instanceId> [<instanceId1> ...]",
+		Aliases: []string{"st", "stat", "ls"},
+		Short:   "Show migration status of instance(s)",
+		PreRunE: checkAtLeastArgs(1, "Need at least 1 instance ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			for i, instanceId := range args {
+				if status, err := client.GetMigrationStatus(instanceId); err != nil {
+					die("failed to query %s migration status: %s", instanceId, err)
+				} else if cmd.Flags().Lookup("json").Value.String() != "true" {
+					if i > 0 {
+						fmt.Println("")
+					}
+					fmt.Printf("%s migration:\n", instanceId)
+					printMigrationStatus(status)
+				}
+			}
+		},
+	}
+
+	// Drive all migration stages in order, resuming where a previous run left off
+	migrateAll = &cobra.Command{
+		Use:     "all  <instanceId>",
+		Aliases: []string{"start", "resume"},
+		Short:   "Run (or resume) all migration stages in order",
+		PreRunE: checkArgs(1, "Need an instance ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var instanceId = args[0]
+
+		stages:
+			for {
+				status, err := client.GetMigrationStatus(instanceId)
+				if err != nil {
+					die("failed to query %s migration status: %s", instanceId, err)
+				}
+
+				// Resume: wait for any stage that is still in progress from a previous run.
+				for _, s := range status {
+					if s.Processing() {
+						fmt.Printf("%s: waiting for %s to complete ...\n", instanceId, s.Stage)
+						if _, err := client.WaitForInstance(instanceId, migrateFlags.interval); err != nil {
+							die("failed to wait for %s: %s", instanceId, err)
+						}
+						continue stages
+					}
+				}
+
+				stage, retry, ok := status.Next()
+				if !ok || (stage == clccam.InstanceOp_cleanup_migration && migrateFlags.noCleanup) {
+					fmt.Printf("%s: migration completed.\n", instanceId)
+					printMigrationStatus(status)
+					return
+				} else if stage == clccam.InstanceOp_test_migration && migrateFlags.noTest && !retry {
+					// Test-failover is optional; skip it by running the actual migration directly.
+					stage = clccam.InstanceOp_run_migration
+				}
+
+				if retry {
+					if !migrateFlags.retry {
+						printMigrationStatus(status)
+						die("%s: %s failed - re-run with --retry, or use 'migrate retry'", instanceId, stage)
+					}
+					stage = clccam.InstanceOp_retry_migration
+				}
+
+				if err := runMigrationStage(instanceId, stage, true); err != nil {
+					die("%s", err)
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	cmdMigrate.PersistentFlags().DurationVar(&migrateFlags.interval, "interval", 15*time.Second, "Polling interval while waiting for a stage to complete")
+	cmdMigrate.PersistentFlags().BoolVarP(&migrateFlags.force, "force", "f", false, "Skip the migration prerequisite checks")
+
+	migrateAll.Flags().BoolVar(&migrateFlags.retry, "retry", false, "Automatically retry a failed stage")
+	migrateAll.Flags().BoolVar(&migrateFlags.noTest, "no-test", false, "Skip the test-failover stage")
+	migrateAll.Flags().BoolVar(&migrateFlags.noCleanup, "no-cleanup", false, "Skip the cleanup stage")
+
+	cmdMigrate.AddCommand(migrateStatus, migrateAll,
+		migrateStageCmd(clccam.InstanceOp_prepare_migration, "prepare", "Prepare migration infrastructure", "prep"),
+		migrateStageCmd(clccam.InstanceOp_test_migration, "test", "Perform migration test-failover", "test-failover"),
+		migrateStageCmd(clccam.InstanceOp_run_migration, "run", "Perform the actual migration", "failover"),
+		migrateStageCmd(clccam.InstanceOp_retry_migration, "retry", "Retry the failed migration stage", "re-try"),
+		migrateStageCmd(clccam.InstanceOp_cleanup_migration, "cleanup", "Remove migration infrastructure", "clean"),
+	)
+	Root.AddCommand(cmdMigrate)
+}
+
+// migrateStageCmd returns a command that runs the single migration stage @op.
+func migrateStageCmd(op clccam.InstanceOp, use, short string, aliases ...string) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:     use + "  <instanceId> [<instanceId1> ...]",
+		Aliases: aliases,
+		Short:   short,
+		PreRunE: checkAtLeastArgs(1, "Need at least 1 instance ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, instanceId := range args {
+				if err := runMigrationStage(instanceId, op, migrateFlags.wait); err != nil {
+					die("%s", err)
+				}
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&migrateFlags.wait, "wait", "w", false, "Wait for the stage to complete")
+	return cmd
+}
+
+// runMigrationStage checks the prerequisites of @op and runs it on @instanceId.
+// If @wait is set, it waits for the stage to complete and verifies that it succeeded.
+func runMigrationStage(instanceId string, op clccam.InstanceOp, wait bool) error {
+	var stage = op
+
+	status, err := client.GetMigrationStatus(instanceId)
+	if err != nil {
+		return errors.Errorf("failed to query %s migration status: %s", instanceId, err)
+	} else if err := status.CheckPrerequisites(op); err != nil && !migrateFlags.force {
+		return errors.Errorf("%s: %s", instanceId, err)
+	}
+
+	if op == clccam.InstanceOp_retry_migration {
+		stage, _, _ = status.Next()
+		fmt.Printf("%s: retrying %s ...\n", instanceId, stage)
+	} else {
+		fmt.Printf("%s: running %s ...\n", instanceId, stage)
+	}
+
+	if err := client.MigrateInstance(instanceId, op); err != nil {
+		return errors.Errorf("failed to %s %s: %s", op, instanceId, err)
+	} else if !wait {
+		return nil
+	}
+
+	// Give the server time to register the operation before polling the instance state.
+	time.Sleep(migrateFlags.interval)
+
+	if _, err := client.WaitForInstance(instanceId, migrateFlags.interval); err != nil {
+		return errors.Errorf("failed to wait for %s: %s", instanceId, err)
+	} else if status, err = client.GetMigrationStatus(instanceId); err != nil {
+		return errors.Errorf("failed to query %s migration status: %s", instanceId, err)
+	} else if s, err := status.Stage(stage); err != nil {
+		return err
+	} else if !s.Done() {
+		printMigrationStatus(status)
+		return errors.Errorf("%s: %s did not complete (%s)", instanceId, stage, s)
+	}
+	fmt.Printf("%s: %s completed.\n", instanceId, stage)
+	return nil
+}
+
+// printMigrationStatus prints the per-stage migration @status.
+func printMigrationStatus(status clccam.MigrationStatus) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Stage", "State", "Started", "Duration", "User"})
+	for _, s := range status {
+		var started, duration, user = "n/a", "n/a", ""
+
+		if op := s.Operation; op != nil {
+			started = humanize.Time(op.Created.Time.Local())
+			user = op.Username
+
+			if s.Processing() {
+				duration = fmt.Sprintf("%s so far", time.Since(op.Created.Time).Round(time.Second))
+			} else if !op.Updated.Time.IsZero() {
+				duration = op.Updated.Time.Sub(op.Created.Time).Round(time.Second).String()
+			}
+		}
+		table.Append([]string{s.Stage.String(), s.String(), started, duration, user})
+	}
+	table.Render()
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Name of the file below $CLC_HOME that records which events have already been notified.
+const notifyCursorFile = "notify.cursor"
+
+// Maximum number of recent event keys retained for de-duplication.
+const notifyMaxSeen = 1000
+
+var (
+	notifyFlags struct {
+		config   string        // Path to the notification configuration
+		interval time.Duration // Polling interval
+		dryRun   bool          // Print events instead of notifying
+	}
+
+	// Long-running notification process
+	notifyCmd = &cobra.Command{
+		Use:   "notify  -c <notify.yaml>",
+		Short: "Send notifications on instance state changes",
+		Long: `Watches instances and notifies webhooks and/or local commands when an instance
+becomes unavailable, an operation finishes, or an activity fails with a non-zero exit code.
+
+Configuration (YAML):
+  events:   [ unavailable, operation_finished, activity_failed ]  # default; or any watch event type
+  retries:  3                                                     # attempts per webhook/command
+  retry_delay: 5s
+  webhooks:
+    - url: https://chat.example.com/hooks/xyz
+      headers: { Authorization: "Bearer ..." }
+      template: '{"text": {{json .String}}}'                       # default: the event as JSON
+  commands:
+    - /usr/local/bin/page-oncall.sh                                # event passed via CAM_EVENT_* variables`,
+		Run: func(cmd *cobra.Command, args []string) {
+			n, err := newNotifier(notifyFlags.config)
+			if err != nil {
+				die("%s", err)
+			}
+
+			var w = clccam.NewWatcher(client, notifyFlags.interval)
+
+			w.Operations = true
+			w.Since = n.cursor.Last
+
+			for evt := range w.Watch(signalContext()) {
+				if evt.Type == clccam.WatchError {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", evt.Time.Local().Format("_2 Jan 15:04:05"), evt)
+				} else if !n.matches(evt) {
+				} else if notifyFlags.dryRun {
+					fmt.Printf("%s  would notify: %s\n", evt.Time.Local().Format("_2 Jan 15:04:05"), evt)
+				} else if err := n.notify(evt); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to notify %s: %s\n", evt, err)
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	notifyCmd.Flags().StringVarP(&notifyFlags.config, "config", "c", path.Join(clccam.GetClcHome(), "notify.yaml"), "Path to the notification configuration")
+	notifyCmd.Flags().DurationVarP(&notifyFlags.interval, "interval", "i", 30*time.Second, "Polling interval")
+	notifyCmd.Flags().BoolVarP(&notifyFlags.dryRun, "dry-run", "n", false, "Print matching events instead of notifying")
+
+	Root.AddCommand(notifyCmd)
+}
+
+// notifyConfig is the YAML configuration of the notifier.
+type notifyConfig struct {
+	// Events to notify: watch event types, or "unavailable" (an instance became unavailable).
+	Events []string `json:"events"`
+
+	// Number of attempts per webhook/command.
+	Retries int `json:"retries"`
+
+	// Initial delay between attempts, doubled after each attempt.
+	RetryDelay string `json:"retry_delay"`
+
+	// Webhooks to POST the event to.
+	Webhooks []struct {
+		URL      string            `json:"url"`
+		Headers  map[string]string `json:"headers"`
+		Template string            `json:"template"`
+	} `json:"webhooks"`
+
+	// Local commands to run, with the event passed via the environment.
+	Commands []string `json:"commands"`
+}
+
+// notifyCursor is persisted below $CLC_HOME so that restarts do not re-fire old events.
+type notifyCursor struct {
+	// Time of the most recent event notified
+	Last time.Time `json:"last"`
+
+	// Keys of the most recently notified events
+	Seen []string `json:"seen"`
+}
+
+// notifier delivers events to webhooks and local commands.
+type notifier struct {
+	cfg        notifyConfig
+	events     map[string]bool
+	templates  []*template.Template
+	retryDelay time.Duration
+	cursor     notifyCursor
+	seen       map[string]bool
+	http       *http.Client
+}
+
+// newNotifier loads the notifier configuration from @configPath, and the cursor from $CLC_HOME.
+func newNotifier(configPath string) (*notifier, error) {
+	var n = &notifier{
+		events:     make(map[string]bool),
+		seen:       make(map[string]bool),
+		retryDelay: 5 * time.Second,
+		http:       &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if content, err := ioutil.ReadFile(configPath); err != nil {
+		return nil, errors.Errorf("unable to read notification configuration: %s", err)
+	} else if err = yaml.Unmarshal(content, &n.cfg); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize %s", configPath)
+	} else if len(n.cfg.Webhooks) == 0 && len(n.cfg.Commands) == 0 {
+		return nil, errors.Errorf("%s: no webhooks or commands configured", configPath)
+	}
+
+	if len(n.cfg.Events) == 0 {
+		n.cfg.Events = []string{"unavailable", string(clccam.WatchOperationFinished), string(clccam.WatchActivityFailed)}
+	}
+	for _, e := range n.cfg.Events {
+		n.events[e] = true
+	}
+
+	if n.cfg.Retries < 1 {
+		n.cfg.Retries = 3
+	}
+	if n.cfg.RetryDelay != "" {
+		d, err := time.ParseDuration(n.cfg.RetryDelay)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid retry_delay %q", n.cfg.RetryDelay)
+		}
+		n.retryDelay = d
+	}
+
+	for i, hook := range n.cfg.Webhooks {
+		var tmpl *template.Template
+
+		if hook.URL == "" {
+			return nil, errors.Errorf("webhook #%d: missing URL", i+1)
+		} else if hook.Template != "" {
+			t, err := template.New(hook.URL).Funcs(template.FuncMap{
+				"json": func(v interface{}) (string, error) {
+					b, err := json.Marshal(v)
+					return string(b), err
+				},
+			}).Parse(hook.Template)
+			if err != nil {
+				return nil, errors.Wrapf(err, "webhook %s: invalid template", hook.URL)
+			}
+			tmpl = t
+		}
+		n.templates = append(n.templates, tmpl)
+	}
+
+	if content, err := ioutil.ReadFile(path.Join(clccam.GetClcHome(), notifyCursorFile)); err == nil {
+		if err := json.Unmarshal(content, &n.cursor); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", notifyCursorFile)
+		}
+		for _, key := range n.cursor.Seen {
+			n.seen[key] = true
+		}
+	}
+	return n, nil
+}
+
+// matches returns true if @evt is one of the configured events.
+func (n *notifier) matches(evt clccam.WatchEvent) bool {
+	if evt.Type == clccam.WatchStateChanged && evt.State == clccam.InstanceState_unavailable.String() {
+		return n.events["unavailable"] || n.events[string(evt.Type)]
+	}
+	return n.events[string(evt.Type)]
+}
+
+// notify delivers @evt unless it has been notified already, and updates the persisted cursor.
+func (n *notifier) notify(evt clccam.WatchEvent) error {
+	var key = eventKey(evt)
+
+	if n.seen[key] {
+		return nil
+	} else if err := n.deliver(evt); err != nil {
+		return err
+	}
+
+	n.seen[key] = true
+	n.cursor.Seen = append(n.cursor.Seen, key)
+	if len(n.cursor.Seen) > notifyMaxSeen {
+		for _, old := range n.cursor.Seen[:len(n.cursor.Seen)-notifyMaxSeen] {
+			delete(n.seen, old)
+		}
+		n.cursor.Seen = n.cursor.Seen[len(n.cursor.Seen)-notifyMaxSeen:]
+	}
+	if evt.Time.After(n.cursor.Last) {
+		n.cursor.Last = evt.Time
+	}
+	return n.saveCursor()
+}
+
+// deliver sends @evt to all configured webhooks and commands, retrying each on failure.
+func (n *notifier) deliver(evt clccam.WatchEvent) error {
+	var failed []string
+
+	for i, hook := range n.cfg.Webhooks {
+		if err := n.retry(func() error { return n.post(hook.URL, hook.Headers, n.templates[i], evt) }); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", hook.URL, err))
+		}
+	}
+	for _, command := range n.cfg.Commands {
+		if err := n.retry(func() error { return runEventCommand(command, evt) }); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", command, err))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// retry runs @fn up to the configured number of attempts, with exponential backoff.
+func (n *notifier) retry(fn func() error) (err error) {
+	for i, delay := 0, n.retryDelay; i < n.cfg.Retries; i, delay = i+1, delay*2 {
+		if err = fn(); err == nil {
+			return nil
+		} else if i+1 < n.cfg.Retries {
+			time.Sleep(delay)
+		}
+	}
+	return err
+}
+
+// post sends @evt to @url, rendered via @tmpl if non-nil, or as JSON otherwise.
+func (n *notifier) post(url string, headers map[string]string, tmpl *template.Template, evt clccam.WatchEvent) error {
+	var body bytes.Buffer
+
+	if tmpl == nil {
+		if err := json.NewEncoder(&body).Encode(evt); err != nil {
+			return err
+		}
+	} else if err := tmpl.Execute(&body, evt); err != nil {
+		return errors.Wrapf(err, "failed to render template")
+	}
+
+	req, err := http.NewRequest("POST", url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	for name, val := range headers {
+		req.Header.Set(name, val)
+	}
+
+	res, err := n.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(res.Status)
+	}
+	return nil
+}
+
+// saveCursor persists the notification cursor below $CLC_HOME.
+func (n *notifier) saveCursor() error {
+	var clcHome = clccam.GetClcHome()
+
+	b, err := json.Marshal(n.cursor)
+	if err != nil {
+		return err
+	} else if err := os.MkdirAll(clcHome, 0700); err != nil {
+		return errors.Errorf("failed to create CLC directory %s: %s", clcHome, err)
+	}
+	return ioutil.WriteFile(path.Join(clcHome, notifyCursorFile), b, 0600)
+}
+
+// runEventCommand runs @command via the shell, passing @evt in CAM_EVENT_* environment variables.
+func runEventCommand(command string, evt clccam.WatchEvent) error {
+	var cmd *exec.Cmd
+
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(),
+		"CAM_EVENT_TYPE="+string(evt.Type),
+		"CAM_EVENT_TIME="+evt.Time.Format(time.RFC3339),
+		"CAM_EVENT_INSTANCE="+evt.Instance,
+		"CAM_EVENT_NAME="+evt.Name,
+		"CAM_EVENT_OWNER="+evt.Owner,
+		"CAM_EVENT_OPERATION="+evt.Operation,
+		"CAM_EVENT_OLD_STATE="+evt.OldState,
+		"CAM_EVENT_STATE="+evt.State,
+		"CAM_EVENT_MACHINE="+evt.Machine,
+		fmt.Sprintf("CAM_EVENT_EXIT_CODE=%d", evt.ExitCode),
+		"CAM_EVENT_TEXT="+evt.Text,
+		"CAM_EVENT_JSON="+string(b),
+	)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+
+	return cmd.Run()
+}
+
+// eventKey returns a key that identifies @evt for de-duplication.
+func eventKey(evt clccam.WatchEvent) string {
+	return strings.Join([]string{
+		string(evt.Type), evt.Instance, evt.OperationID, evt.Machine, evt.State, evt.Time.UTC().Format(time.RFC3339Nano),
+	}, "|")
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Name of the file below $CLC_HOME that records which lifespan events have already been notified.
+// Separate from the cursor of the 'notify' command, which may run at the same time.
+const reapCursorFile = "reap.cursor"
+
+var (
+	reapFlags struct {
+		policy     string // Path to the lifespan policy
+		defaultTTL string // Overrides the default TTL of the policy
+		action     string // Overrides the action of the policy
+		warnBefore string // Overrides the warning period of the policy
+		notify     string // Path to the notification configuration, if owners are to be notified
+		execute    bool   // Whether to actually shut down / terminate
+		output     string // Output format
+	}
+
+	// Lifespan enforcement
+	reapCmd = &cobra.Command{
+		Use:   "reap",
+		Short: "Shut down or terminate instances that have exceeded their lifespan",
+		Long: `Finds instances that have exceeded their time-to-live (TTL), and shuts down or terminates them.
+Without --execute, only reports what would be done.
+
+The TTL of an instance is taken from its "ttl=<duration>" tag (e.g. "ttl=72h", "ttl=7d", "ttl=never"),
+or from the first matching rule of the lifespan policy, or from its default TTL.
+The action is taken from the lifespan of the instance box, the matching rule, or the policy.
+
+Lifespan policy (YAML):
+  default_ttl: 14d                # unlimited if empty
+  action:      shutdown           # or terminate
+  warn_before: 24h                # warn owners this long before expiry
+  rules:
+    - tags:  [ sandbox ]
+      ttl:   72h
+      action: terminate
+    - owner: production
+      ttl:   never`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return checkOutputFormat(reapFlags.output, "table", "json")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var n *notifier
+
+			policy, err := clccam.LoadLifespanPolicy(reapFlags.policy)
+			if err != nil {
+				die("%s", err)
+			}
+			if reapFlags.defaultTTL != "" {
+				policy.DefaultTTL = reapFlags.defaultTTL
+			}
+			if reapFlags.action != "" {
+				policy.Action = reapFlags.action
+			}
+			if reapFlags.warnBefore != "" {
+				policy.WarnBefore = reapFlags.warnBefore
+			}
+			if err := policy.Validate(); err != nil {
+				die("%s", err)
+			}
+
+			var notified = make(map[string]bool) // keys of the lifespan events notified already
+			if reapFlags.notify != "" {
+				if n, err = newNotifier(reapFlags.notify); err != nil {
+					die("%s", err)
+				} else if notified, err = loadReapNotified(); err != nil {
+					die("%s", err)
+				}
+			}
+
+			instances, err := client.GetInstances()
+			if err != nil {
+				die("failed to query instances: %s", err)
+			}
+
+			var (
+				now    = time.Now()
+				reaped []reapResult
+				failed int
+			)
+
+			for i := range instances {
+				if s, ok := policy.Evaluate(&instances[i], now); ok && (s.Expired || s.Expiring) {
+					reaped = append(reaped, reapResult{LifespanStatus: s})
+				}
+			}
+			sort.Slice(reaped, func(i, j int) bool {
+				return reaped[i].Expires.Before(reaped[j].Expires)
+			})
+
+			for i := range reaped {
+				var r = &reaped[i]
+
+				if !r.Expired {
+					r.Result = "warning"
+				} else if !reapFlags.execute {
+					r.Result = "dry run"
+				} else if skipped, err := client.EnforceLifespan(r.LifespanStatus); err != nil {
+					r.Result = "FAILED: " + err.Error()
+					failed++
+				} else if skipped != "" {
+					r.Result = "skipped: " + skipped
+				} else {
+					r.Result = "done"
+				}
+
+				// Only notify about warnings, and about actions that were actually performed.
+				// The event key contains the expiry time, so that each deadline is notified once.
+				if evt := r.Event(); n != nil && (r.Result == "warning" || r.Result == "done") && !notified[eventKey(evt)] {
+					if err := n.deliver(evt); err != nil {
+						fmt.Fprintf(os.Stderr, "failed to notify %s: %s\n", r.Instance, err)
+					} else {
+						notified[eventKey(evt)] = true
+					}
+				}
+			}
+
+			if n != nil {
+				if err := saveReapNotified(notified, now); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to save %s: %s\n", reapCursorFile, err)
+				}
+			}
+
+			if reapFlags.output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "\t")
+				if err := enc.Encode(reaped); err != nil {
+					die("failed to encode results: %s", err)
+				}
+			} else if len(reaped) == 0 {
+				fmt.Println("No instances have exceeded their lifespan.")
+			} else {
+				printReaped(reaped)
+				if !reapFlags.execute {
+					fmt.Println("\nDry run - use --execute to shut down / terminate expired instances.")
+				}
+			}
+
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+func init() {
+	reapCmd.Flags().StringVarP(&reapFlags.policy, "policy", "f", path.Join(clccam.GetClcHome(), "lifespan.yaml"), "Path to the lifespan policy")
+	reapCmd.Flags().StringVar(&reapFlags.defaultTTL, "ttl", "", "Default TTL, overriding that of the policy (e.g. 72h, 7d)")
+	reapCmd.Flags().StringVar(&reapFlags.action, "action", "", "Action on expiry, overriding that of the policy (shutdown or terminate)")
+	reapCmd.Flags().StringVar(&reapFlags.warnBefore, "warn-before", "", "Warning period, overriding that of the policy (e.g. 24h)")
+	reapCmd.Flags().StringVar(&reapFlags.notify, "notify", "", "Notify owners using this notification configuration (see 'notify')")
+	reapCmd.Flags().BoolVar(&reapFlags.execute, "execute", false, "Shut down / terminate expired instances (default is a dry run)")
+	reapCmd.Flags().StringVarP(&reapFlags.output, "output", "o", "table", "Output format (table or json)")
+
+	Root.AddCommand(reapCmd)
+}
+
+// reapResult records the outcome of enforcing the lifespan of an instance.
+type reapResult struct {
+	clccam.LifespanStatus
+
+	// Outcome, e.g. "done", "dry run", "skipped: ..."
+	Result string `json:"result"`
+}
+
+// loadReapNotified returns the keys of the lifespan events notified by previous runs.
+func loadReapNotified() (map[string]bool, error) {
+	var keys []string
+	var res = make(map[string]bool)
+
+	if content, err := ioutil.ReadFile(path.Join(clccam.GetClcHome(), reapCursorFile)); os.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return nil, errors.Errorf("unable to read %s: %s", reapCursorFile, err)
+	} else if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode %s", reapCursorFile)
+	}
+	for _, key := range keys {
+		res[key] = true
+	}
+	return res, nil
+}
+
+// saveReapNotified persists the keys of @notified below $CLC_HOME.
+// Keys of events whose time lies more than a week before @now are dropped.
+func saveReapNotified(notified map[string]bool, now time.Time) error {
+	var (
+		clcHome = clccam.GetClcHome()
+		keys    []string
+	)
+
+	for key := range notified {
+		// The event time is the last field of the key (see eventKey).
+		if t, err := time.Parse(time.RFC3339Nano, key[strings.LastIndex(key, "|")+1:]); err != nil || t.After(now.AddDate(0, 0, -7)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	} else if err := os.MkdirAll(clcHome, 0700); err != nil {
+		return errors.Errorf("failed to create CLC directory %s: %s", clcHome, err)
+	}
+	return ioutil.WriteFile(path.Join(clcHome, reapCursorFile), b, 0600)
+}
+
+// printReaped prints @reaped as a table.
+func printReaped(reaped []reapResult) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Instance", "Name", "Owner", "TTL", "Source", "Expires", "Action", "Result"})
+	for _, r := range reaped {
+		table.Append([]string{
+			r.Instance,
+			r.Name,
+			r.Owner,
+			r.TTL.String(),
+			r.Source,
+			humanize.Time(r.Expires.Local()),
+			string(r.Action),
+			r.Result,
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Name of the file below $CLC_HOME that records the actions of the scheduler.
+const schedulerJournalFile = "scheduler.journal"
+
+var (
+	schedulerFlags struct {
+		file    string // Path to the schedule definition
+		journal string // Path to the journal
+		dryRun  bool   // Only log what would be done
+		from    string // Start of the plan interval
+		to      string // End of the plan interval
+	}
+
+	// Power scheduler
+	cmdScheduler = &cobra.Command{
+		Use:     "scheduler",
+		Aliases: []string{"sched"},
+		Short:   "Power instances off and on according to schedules",
+		Long: `Powers instances off and on at the times given by cron expressions.
+
+Schedule definition (YAML):
+  timezone: America/Chicago           # default timezone of all schedules
+  schedules:
+    - name: nightly
+      tags: [ non-prod ]              # instances that have all of these tags
+      instances: [ i-abc123 ]         # and/or individual instances
+      timezone: Europe/Berlin         # optional override
+      power_off: "0 20 * * 1-5"       # standard 5-field cron expressions
+      power_on:  "0 7 * * 1-5"`,
+	}
+
+	// Long-running scheduler process
+	schedulerRun = &cobra.Command{
+		Use:   "run  [-f <schedules.yaml>]",
+		Short: "Run the scheduler, executing power actions when due",
+		Run: func(cmd *cobra.Command, args []string) {
+			schedules, err := clccam.LoadPowerSchedules(schedulerFlags.file)
+			if err != nil {
+				die("%s", err)
+			}
+
+			var (
+				ctx  = signalContext()
+				last = time.Now()
+			)
+
+			for {
+				var next = schedules.Next(last)
+
+				if next.IsZero() {
+					die("no upcoming scheduled actions")
+				}
+				fmt.Fprintf(os.Stderr, "Next scheduled action at %s\n", next.Local().Format("Mon _2 Jan 15:04 MST"))
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(next)):
+				}
+
+				var now = time.Now()
+
+				instances, err := client.GetInstances()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to query instances: %s - retrying in 1 minute\n", err)
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(time.Minute):
+					}
+					continue // @last is not advanced, so that the due actions are retried
+				}
+
+				for _, a := range schedules.Plan(instances, last, now) {
+					var entry = journalEntry{ScheduledAction: a, Executed: time.Now()}
+
+					if schedulerFlags.dryRun {
+						entry.Skipped = "dry run"
+					} else if entry.Skipped, err = client.ApplyScheduledAction(a); err != nil {
+						entry.Error = err.Error()
+					}
+					fmt.Println(entry)
+
+					if err := appendJournal(schedulerFlags.journal, entry); err != nil {
+						fmt.Fprintf(os.Stderr, "failed to update journal: %s\n", err)
+					}
+				}
+				last = now
+			}
+		},
+	}
+
+	// Preview of scheduled actions
+	schedulerPlan = &cobra.Command{
+		Use:   "plan  [-f <schedules.yaml>] [--from <time>] [--to <time>]",
+		Short: "Preview the actions due in a time interval",
+		Run: func(cmd *cobra.Command, args []string) {
+			var from, to = time.Now(), time.Time{}
+
+			schedules, err := clccam.LoadPowerSchedules(schedulerFlags.file)
+			if err != nil {
+				die("%s", err)
+			}
+
+			if schedulerFlags.from != "" {
+				if from, err = parseTimeFlag(schedulerFlags.from); err != nil {
+					die("invalid --from: %s", err)
+				}
+			}
+			if schedulerFlags.to == "" {
+				to = from.Add(24 * time.Hour)
+			} else if to, err = parseTimeFlag(schedulerFlags.to); err != nil {
+				die("invalid --to: %s", err)
+			} else if !to.After(from) {
+				die("--to must be later than --from")
+			}
+
+			instances, err := client.GetInstances()
+			if err != nil {
+				die("failed to query instances: %s", err)
+			}
+
+			actions := schedules.Plan(instances, from, to)
+			if len(actions) == 0 {
+				fmt.Printf("No actions scheduled between %s and %s.\n",
+					from.Local().Format("_2 Jan 15:04 MST"), to.Local().Format("_2 Jan 15:04 MST"))
+				return
+			}
+
+			var table = tablewriter.NewWriter(os.Stdout)
+
+			table.SetAutoFormatHeaders(false)
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.SetAutoWrapText(false)
+
+			table.SetHeader([]string{"Time", "Action", "Instance", "Name", "Schedule"})
+			for _, a := range actions {
+				table.Append([]string{
+					a.Time.Local().Format("Mon _2 Jan 15:04 MST"),
+					string(a.Action),
+					a.Instance,
+					a.Name,
+					a.Schedule,
+				})
+			}
+			table.Render()
+		},
+	}
+)
+
+func init() {
+	var clcHome = clccam.GetClcHome()
+
+	cmdScheduler.PersistentFlags().StringVarP(&schedulerFlags.file, "file", "f", path.Join(clcHome, "schedules.yaml"), "Path to the schedule definition")
+
+	schedulerRun.Flags().StringVar(&schedulerFlags.journal, "journal", path.Join(clcHome, schedulerJournalFile), "Path to the journal of executed actions")
+	schedulerRun.Flags().BoolVarP(&schedulerFlags.dryRun, "dry-run", "n", false, "Only log the actions that are due")
+
+	schedulerPlan.Flags().StringVar(&schedulerFlags.from, "from", "", "Start of the interval (default: now)")
+	schedulerPlan.Flags().StringVar(&schedulerFlags.to, "to", "", "End of the interval (default: 24h after --from)")
+
+	cmdScheduler.AddCommand(schedulerRun, schedulerPlan)
+	Root.AddCommand(cmdScheduler)
+}
+
+// journalEntry records the outcome of a scheduled action.
+type journalEntry struct {
+	clccam.ScheduledAction
+
+	// Time the action was executed
+	Executed time.Time `json:"executed"`
+
+	// Reason the action was skipped, if any
+	Skipped string `json:"skipped,omitempty"`
+
+	// Error message if the action failed
+	Error string `json:"error,omitempty"`
+}
+
+func (e journalEntry) String() string {
+	var s = fmt.Sprintf("%s  %-9s %s (%s) [%s]", e.Executed.Local().Format("_2 Jan 15:04:05"), e.Action, e.Instance, e.Name, e.Schedule)
+
+	if e.Error != "" {
+		s += ": FAILED: " + e.Error
+	} else if e.Skipped != "" {
+		s += ": skipped: " + e.Skipped
+	}
+	return s
+}
+
+// appendJournal appends @entry as a JSON line to the journal at @journalPath.
+func appendJournal(journalPath string, entry journalEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	} else if err := os.MkdirAll(path.Dir(journalPath), 0700); err != nil {
+		return errors.Errorf("failed to create journal directory: %s", err)
+	}
+
+	f, err := os.OpenFile(journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseTimeFlag parses @s as RFC3339 time, or as local "YYYY-MM-DD HH:MM" / "YYYY-MM-DD".
+func parseTimeFlag(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("unable to parse time %q (expecting RFC3339, YYYY-MM-DD HH:MM or YYYY-MM-DD)", s)
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	timelineFlags struct {
+		op    string // Restrict phases to this operation
+		gantt bool   // Whether to print an ASCII Gantt chart of the phases
+		width int    // Width of the Gantt chart bars
+	}
+
+	// Print the merged timeline of state history, operations and activities
+	instanceTimeline = &cobra.Command{
+		Use:     "timeline  <instanceId>",
+		Aliases: []string{"time", "tl", "history"},
+		Short:   "Show the merged timeline of an instance",
+		PreRunE: checkArgs(1, "Need an instance ID"),
+		Run: func(cmd *cobra.Command, args []string) {
+			var phases []clccam.TimelinePhase
+
+			if timelineFlags.op != "" {
+				if _, err := clccam.InstanceOpFromString(timelineFlags.op); err != nil {
+					die("%s", err)
+				}
+			}
+
+			t, err := client.GetInstanceTimeline(args[0])
+			if err != nil {
+				die("failed to query %s timeline: %s", args[0], err)
+			} else if cmd.Flags().Lookup("json").Value.String() == "true" {
+				return
+			} else if len(t.Entries) == 0 {
+				fmt.Printf("No %s history available.\n", args[0])
+				return
+			}
+
+			for _, p := range t.Phases {
+				if timelineFlags.op == "" || p.Operation.String() == timelineFlags.op {
+					phases = append(phases, p)
+				}
+			}
+
+			fmt.Printf("%s timeline:\n", args[0])
+			printTimeline(t.Entries)
+
+			if len(phases) > 0 {
+				fmt.Printf("\n%s phases:\n", args[0])
+				printPhases(phases)
+
+				if timelineFlags.gantt {
+					fmt.Println("")
+					printGantt(phases, timelineFlags.width)
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	instanceTimeline.Flags().StringVar(&timelineFlags.op, "op", "", "Restrict phases to this operation (optional)")
+	instanceTimeline.Flags().BoolVarP(&timelineFlags.gantt, "gantt", "g", false, "Print an ASCII Gantt chart of the phases")
+	instanceTimeline.Flags().IntVar(&timelineFlags.width, "width", 60, "Width of the Gantt chart")
+
+	cmdInstances.AddCommand(instanceTimeline)
+}
+
+// printTimeline prints the timeline @entries in tabulated form.
+func printTimeline(entries []clccam.TimelineEntry) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Time", "Kind", "Duration", "Machine", "Level", "Text"})
+	for _, e := range entries {
+		var duration string
+
+		if d := e.Duration(); d > 0 {
+			duration = d.Round(time.Second).String()
+		}
+		table.Append([]string{
+			e.Start.Local().Format("_2 Jan  15:04:05.0"),
+			string(e.Kind),
+			duration,
+			e.Machine,
+			e.Level,
+			fmt.Sprintf("%-.80s", e.Text), // Chop off at 80 characters
+		})
+	}
+	table.Render()
+}
+
+// printPhases prints the operation @phases in tabulated form.
+func printPhases(phases []clccam.TimelinePhase) {
+	var table = tablewriter.NewWriter(os.Stdout)
+
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+
+	table.SetHeader([]string{"Operation", "Phase", "Machine", "Start", "Offset", "Duration"})
+	for _, p := range phases {
+		table.Append([]string{
+			p.Operation.String(),
+			p.String(),
+			p.Machine,
+			p.Start.Local().Format("_2 Jan  15:04:05"),
+			fmt.Sprintf("+%s", p.Start.Sub(p.OperationStart).Round(time.Second)),
+			p.Duration().Round(time.Second).String(),
+		})
+	}
+	table.Render()
+}
+
+// printGantt renders @phases as an ASCII Gantt chart, using @width columns for the time axis.
+// Phases that have not ended yet are drawn up to the current time.
+func printGantt(phases []clccam.TimelinePhase, width int) {
+	var (
+		now        = time.Now()
+		start      = phases[0].Start
+		end        time.Time // latest end of all phases
+		labels     = make([]string, len(phases))
+		labelWidth int
+	)
+
+	// phaseEnd returns the end of phase @p, or the current time if it is still running.
+	phaseEnd := func(p clccam.TimelinePhase) time.Time {
+		if p.End.IsZero() {
+			return now
+		}
+		return p.End
+	}
+
+	if width < 10 {
+		width = 10
+	}
+
+	for i, p := range phases {
+		if p.Start.Before(start) {
+			start = p.Start
+		}
+		if phaseEnd(p).After(end) {
+			end = phaseEnd(p)
+		}
+
+		labels[i] = fmt.Sprintf("%s %s", p.Operation, p)
+		if p.Machine != "" {
+			labels[i] += " @" + p.Machine
+		}
+		if len(labels[i]) > labelWidth {
+			labelWidth = len(labels[i])
+		}
+	}
+
+	var total = end.Sub(start)
+	if total <= 0 {
+		total = time.Second
+	}
+
+	// column maps time @t to a column of the chart.
+	column := func(t time.Time) int {
+		var col = int(float64(t.Sub(start)) / float64(total) * float64(width))
+
+		if col < 0 {
+			col = 0
+		} else if col >= width {
+			col = width - 1
+		}
+		return col
+	}
+
+	fmt.Printf("%-*s |%s| %s\n", labelWidth, "", strings.Repeat("-", width), total.Round(time.Second))
+	for i, p := range phases {
+		var from, to = column(p.Start), column(phaseEnd(p))
+
+		if to < from { // clock skew
+			to = from
+		}
+
+		fmt.Printf("%-*s |%s%s%s| %s\n", labelWidth, labels[i],
+			strings.Repeat(" ", from),
+			strings.Repeat("#", to-from+1),
+			strings.Repeat(" ", width-to-1),
+			p.Duration().Round(time.Second))
+	}
+}
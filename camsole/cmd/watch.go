@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/grrtrr/clccam"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchFlags struct {
+		interval   time.Duration // Polling interval
+		operations bool          // Whether to poll per-instance operations
+		initial    bool          // Whether to report existing instances as created
+		output     string        // Output format: text or jsonl
+	}
+
+	// Poll instances and print change events
+	watchCmd = &cobra.Command{
+		Use:     "watch",
+		Aliases: []string{"w", "events"},
+		Short:   "Watch instances and print change events",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return checkOutputFormat(watchFlags.output, "text", "jsonl")
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			var (
+				w   = clccam.NewWatcher(client, watchFlags.interval)
+				enc = json.NewEncoder(os.Stdout)
+			)
+
+			w.Operations = watchFlags.operations
+			w.EmitInitial = watchFlags.initial
+
+			for evt := range w.Watch(signalContext()) {
+				if watchFlags.output == "jsonl" {
+					if err := enc.Encode(evt); err != nil {
+						die("failed to encode %s event: %s", evt.Type, err)
+					}
+				} else {
+					fmt.Printf("%s  %s\n", evt.Time.Local().Format("_2 Jan 15:04:05"), evt)
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	watchCmd.Flags().DurationVarP(&watchFlags.interval, "interval", "i", 30*time.Second, "Polling interval")
+	watchCmd.Flags().BoolVar(&watchFlags.operations, "operations", false, "Also poll the operations of changed instances")
+	watchCmd.Flags().BoolVar(&watchFlags.initial, "initial", false, "Report existing instances as created on startup")
+	watchCmd.Flags().StringVarP(&watchFlags.output, "output", "o", "text", "Output format: text or jsonl")
+
+	Root.AddCommand(watchCmd)
+}
+
+// checkOutputFormat validates that the output format @format is one of @formats.
+func checkOutputFormat(format string, formats ...string) error {
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid output format %q (expecting %s)", format, strings.Join(formats, " or "))
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
+func signalContext() context.Context {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		sigChan     = make(chan os.Signal, 1)
+	)
+
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+	return ctx
+}
@@ -76,6 +76,11 @@ func (c *Client) WithJsonResponse() *Client {
 	return c.With(JsonResponse(true))
 }
 
+// BaseURL returns the base URL of the CAM endpoint used by @c.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
 // GetTokenSubject returns the subject of the client's token if set.
 func (c *Client) GetTokenSubject() (user string, err error) {
 	if c.token == "" {
@@ -100,6 +105,7 @@ func (c *Client) Get(path string, resModel interface{}) error {
 //                attempting to infer the Content Type from the contents of the buffer;
 //            (b) anything else - will be JSON encoded, with corresponding content-type.
 // @resModel: result model to deserialize, must be a pointer to the expected result, or nil.
+//            A *[]byte result model receives the raw response body.
 // @opts:     per-request options (will override any static RequestOptions that @c has).
 // Evaluates the StatusCode of the BaseResponse (embedded) in @inModel and sets @err accordingly.
 // If @err == nil, fills in @resModel, else returns error.
@@ -190,7 +196,7 @@ func (c *Client) getResponse(urlPath, verb string, reqModel, resModel interface{
 			logger.Debugf("%s", string(body))
 		}
 
-		if c.jsonResponse && len(body) > 0 {
+		if _, raw := resModel.(*[]byte); c.jsonResponse && !raw && len(body) > 0 {
 			var b bytes.Buffer
 
 			if err := json.Indent(&b, body, "", "\t"); err != nil {
@@ -201,6 +207,8 @@ func (c *Client) getResponse(urlPath, verb string, reqModel, resModel interface{
 
 		if resModel != nil {
 			switch val := resModel.(type) {
+			case *[]byte:
+				*val = body
 			case *string:
 				*val = string(body)
 			case *[]string:
@@ -244,9 +252,25 @@ func (c *Client) getResponse(urlPath, verb string, reqModel, resModel interface{
 					errMsg = fmt.Sprintf("Error - %s", msg)
 				}
 			}
-			return errors.Errorf("%s (status: %d)", errMsg, res.StatusCode)
+			return &StatusError{Code: res.StatusCode, Message: fmt.Sprintf("%s (status: %d)", errMsg, res.StatusCode)}
 		}
 		// FIXME: implement temporary / retryable errors (300)
-		return errors.New(res.Status)
+		return &StatusError{Code: res.StatusCode, Message: res.Status}
 	}
 }
+
+// StatusError is returned for API responses with an error status code.
+type StatusError struct {
+	Code    int    // HTTP status code
+	Message string // Error message, including the status code
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns true if @err (or its cause) is a 404 response.
+func IsNotFound(err error) bool {
+	se, ok := errors.Cause(err).(*StatusError)
+	return ok && se.Code == http.StatusNotFound
+}
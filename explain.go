@@ -0,0 +1,192 @@
+package clccam
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Failure Diagnosis
+ *
+ * Cross-references the operations, activities, machine workflow and machine logs of an instance
+ * to locate the activity that caused a deployment to fail.
+ */
+
+// FailureReport consolidates the information related to a failed instance activity.
+type FailureReport struct {
+	// Instance the failure occurred on
+	Instance Instance
+
+	// Operation during which the failure occurred (nil if not known)
+	Operation *InstanceOperation
+
+	// The failing activity
+	Activity InstanceActivity
+
+	// Activities on the same machine that preceded the failure (oldest first)
+	Preceding []InstanceActivity
+
+	// Event script that failed, as listed in the machine workflow (zero if not found)
+	ScriptURL URI
+
+	// Contents of the event script (empty if not available)
+	Script string
+
+	// Excerpt of the machine logs around the failure
+	LogExcerpt []string
+
+	// Line number (1-based) of the first line of @LogExcerpt within the machine logs
+	LogStart int
+
+	// Problems encountered while assembling the report (e.g. script download failed)
+	Warnings []string
+}
+
+// IsFailedActivity returns true if @a reports a failure.
+func IsFailedActivity(a InstanceActivity) bool {
+	return a.ExitCode != 0 || strings.EqualFold(a.Level, "error")
+}
+
+// ExplainInstanceFailure locates the most recent failed activity of @instanceId and assembles a FailureReport.
+// @logContext: number of log lines to include before and after the failure.
+// @preceding:  maximum number of preceding activities to include.
+func (c *Client) ExplainInstanceFailure(instanceId string, logContext, preceding int) (*FailureReport, error) {
+	var report = new(FailureReport)
+
+	instance, err := c.GetInstance(instanceId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query instance %s", instanceId)
+	}
+	report.Instance = instance
+
+	ops, err := c.GetInstanceOperations(instanceId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query %s operations", instanceId)
+	}
+
+	// Most recent operation first.
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Created.Time.After(ops[j].Created.Time)
+	})
+
+	var activities []InstanceActivity
+	for i := range ops {
+		if a, ok := lastFailedActivity(ops[i].Activity); ok {
+			report.Operation, report.Activity = &ops[i], a
+			activities = ops[i].Activity
+			break
+		}
+	}
+
+	// Fall back to the activity log if the operations do not contain the failure.
+	if report.Operation == nil {
+		if activities, err = c.GetInstanceActivity(instanceId, ""); err != nil {
+			return nil, errors.Wrapf(err, "failed to query %s activities", instanceId)
+		} else if a, ok := lastFailedActivity(activities); !ok {
+			return nil, errors.Errorf("%s: no failed activity found", instanceId)
+		} else {
+			report.Activity = a
+		}
+	}
+
+	// Activities on the same machine leading up to the failure.
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Created.Time.Before(activities[j].Created.Time)
+	})
+	for _, a := range activities {
+		if !a.Created.Time.Before(report.Activity.Created.Time) {
+			break
+		} else if a.Machine == report.Activity.Machine {
+			report.Preceding = append(report.Preceding, a)
+		}
+	}
+	if preceding < 0 {
+		preceding = 0
+	}
+	if len(report.Preceding) > preceding {
+		report.Preceding = report.Preceding[len(report.Preceding)-preceding:]
+	}
+
+	// Event script, as recorded in the machine workflow.
+	for _, m := range instance.Service.Machines {
+		if m.Name != report.Activity.Machine && report.Activity.Machine != "" {
+			continue
+		}
+		for _, w := range m.Workflow {
+			if w.Event == report.Activity.Event.String() && (report.Activity.Box == "" || w.Box == report.Activity.Box) {
+				report.ScriptURL = w.Script
+			}
+		}
+	}
+
+	if report.ScriptURL.IsZero() {
+		report.Warnings = append(report.Warnings, "no matching event script in machine workflow")
+	} else if b, err := c.DownloadFile(report.ScriptURL); err != nil {
+		report.Warnings = append(report.Warnings, "failed to download event script: "+err.Error())
+	} else {
+		report.Script = string(b)
+	}
+
+	// Machine logs around the failure.
+	if report.Activity.Machine == "" {
+		report.Warnings = append(report.Warnings, "failed activity does not identify a machine")
+	} else if logs, err := c.GetInstanceMachineLogs(instanceId, report.Activity.Machine); err != nil {
+		report.Warnings = append(report.Warnings, "failed to retrieve machine logs: "+err.Error())
+	} else {
+		report.LogExcerpt, report.LogStart = logExcerpt(strings.Split(logs, "\n"), &report.Activity, logContext)
+	}
+	return report, nil
+}
+
+// lastFailedActivity returns the most recent failed activity among @activities.
+func lastFailedActivity(activities []InstanceActivity) (res InstanceActivity, ok bool) {
+	for _, a := range activities {
+		if IsFailedActivity(a) && (!ok || a.Created.Time.After(res.Created.Time)) {
+			res, ok = a, true
+		}
+	}
+	return res, ok
+}
+
+// logExcerpt returns @context lines before and after the last line of @lines that refers to @a.
+// If no line refers to @a, the tail of @lines is returned. Also returns the 1-based start line.
+func logExcerpt(lines []string, a *InstanceActivity, context int) ([]string, int) {
+	var (
+		match  = -1
+		needle = strings.TrimSpace(a.Text)
+		event  = a.Event.String()
+	)
+
+	if len(needle) > 40 {
+		needle = needle[:40]
+	}
+
+	for i := len(lines) - 1; i >= 0 && match < 0; i-- {
+		if needle != "" && strings.Contains(lines[i], needle) {
+			match = i
+		}
+	}
+	for i := len(lines) - 1; i >= 0 && match < 0; i-- {
+		if strings.Contains(lines[i], event) {
+			match = i
+		}
+	}
+	if match < 0 {
+		match = len(lines) - 1
+	}
+
+	if context < 0 {
+		context = 0
+	}
+
+	var from, to = match - context, match + context + 1
+	if from < 0 {
+		from = 0
+	}
+	if to > len(lines) {
+		to = len(lines)
+	}
+	return lines[from:to], from + 1
+}
@@ -0,0 +1,137 @@
+package clccam
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Directories
+ *
+ * A box directory holds a box definition (box.yaml), its event scripts (events/<event>),
+ * its readme (readme.MD) and the files it refers to, using paths relative to the directory.
+ */
+
+const (
+	// Name of the box definition within a box directory.
+	BoxFileName = "box.yaml"
+
+	// Sub-directories of a box directory.
+	BoxEventsDir    = "events"    // event scripts, named after the event
+	BoxFilesDir     = "files"     // contents of File variables
+	BoxIconsDir     = "icons"     // box icon
+	BoxTemplatesDir = "templates" // template (e.g. CloudFormation)
+)
+
+// ExportBox writes the draft of box @boxId as box directory to @dir, creating @dir if necessary.
+// If @version is non-empty (e.g. "1.2.0"), that version of the box is exported instead.
+// Blob URLs of the box are replaced by the paths of the downloaded files, relative to @dir.
+func (c *Client) ExportBox(boxId, version, dir string) (*Box, error) {
+	var box Box
+	var err error
+
+	if version == "" {
+		if box, err = c.GetBoxDraft(boxId); err != nil {
+			return nil, errors.Wrapf(err, "failed to query box %s", boxId)
+		}
+	} else if box, err = c.GetBoxVersion(boxId, version); err != nil {
+		return nil, err
+	} else if box.BoxVersion != nil {
+		// A version has its own ID; use that of the box, so that the export is imported into the box.
+		box.ID = box.BoxVersion.Box
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Errorf("failed to create box directory: %s", err)
+	}
+
+	// Event scripts: recreated from events/ on import.
+	for evt, e := range box.Events {
+		if err := c.exportBlob(e.Url, dir, path.Join(BoxEventsDir, evt.String())); err != nil {
+			return nil, errors.Wrapf(err, "failed to export %s event", evt)
+		}
+	}
+	box.Events = nil
+
+	// Readme: recreated from readme.MD on import.
+	if !box.Readme.Url.IsZero() {
+		if err := c.exportBlob(box.Readme.Url, dir, ReadmeName); err != nil {
+			return nil, errors.Wrapf(err, "failed to export readme")
+		}
+	}
+	box.Readme = BlobResponse{}
+
+	// Icon
+	if box.IconMetadata != nil && IsBlobURL(box.IconMetadata.Image.String()) {
+		rel := path.Join(BoxIconsDir, path.Base(box.IconMetadata.Image.Path))
+		if err := c.exportBlob(box.IconMetadata.Image, dir, rel); err != nil {
+			return nil, errors.Wrapf(err, "failed to export icon")
+		} else if u, err := UriFromString(rel); err != nil {
+			return nil, err
+		} else {
+			box.IconMetadata.Image = *u
+		}
+	} else if IsBlobURL(box.Icon) {
+		u, err := UriFromString(box.Icon)
+		if err != nil {
+			return nil, err
+		}
+		rel := path.Join(BoxIconsDir, path.Base(u.Path))
+		if err := c.exportBlob(*u, dir, rel); err != nil {
+			return nil, errors.Wrapf(err, "failed to export icon")
+		}
+		box.Icon = rel
+	}
+
+	// Template
+	if box.Template != nil && IsBlobURL(box.Template.Url.String()) {
+		rel := path.Join(BoxTemplatesDir, path.Base(box.Template.Url.Path))
+		if err := c.exportBlob(box.Template.Url, dir, rel); err != nil {
+			return nil, errors.Wrapf(err, "failed to export template")
+		} else if u, err := UriFromString(rel); err != nil {
+			return nil, err
+		} else {
+			box.Template.Url = *u
+		}
+	}
+
+	// File variables
+	for i, v := range box.Variables {
+		if v.Type == "File" && IsBlobURL(v.Value) {
+			u, err := UriFromString(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			// Use the variable name as sub-directory, since different variables may refer to files of the same name.
+			rel := path.Join(BoxFilesDir, v.Name, path.Base(u.Path))
+			if err := c.exportBlob(*u, dir, rel); err != nil {
+				return nil, errors.Wrapf(err, "failed to export File variable %s", v.Name)
+			}
+			box.Variables[i].Value = rel
+		}
+	}
+
+	if b, err := yaml.Marshal(box); err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize %s", BoxFileName)
+	} else if err := ioutil.WriteFile(path.Join(dir, BoxFileName), b, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", BoxFileName)
+	}
+	return &box, nil
+}
+
+// exportBlob downloads the blob at @u to the path @rel relative to @dir.
+func (c *Client) exportBlob(u URI, dir, rel string) error {
+	var dst = path.Join(dir, rel)
+
+	b, err := c.DownloadFile(u)
+	if err != nil {
+		return err
+	} else if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, b, 0644)
+}
@@ -2,6 +2,8 @@ package clccam
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/pkg/errors"
@@ -130,6 +132,128 @@ func (c *Client) GetInstances() (res []Instance, err error) {
 	return res, c.Get("/services/instances", &res)
 }
 
+// PoweredOn returns true unless the last operation of @i shut it down.
+func (i *Instance) PoweredOn() bool {
+	switch i.Operation.Event {
+	case InstanceOp_shutdown, InstanceOp_shutdown_service:
+		return false
+	}
+	return !i.IsTerminated()
+}
+
+// IsTerminated returns true if @i has been terminated.
+func (i *Instance) IsTerminated() bool {
+	switch i.Operation.Event {
+	case InstanceOp_terminate, InstanceOp_terminate_service:
+		return i.State != InstanceState_processing
+	}
+	return !i.Terminated.Time.IsZero()
+}
+
+// HasTag returns true if @tag is among the tags of @i.
+func (i *Instance) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitForInstance polls @instanceId every @interval until it is no longer processing.
+// It returns the instance in its final state, or an error if the client context is cancelled.
+func (c *Client) WaitForInstance(instanceId string, interval time.Duration) (res Instance, err error) {
+	for {
+		if res, err = c.GetInstance(instanceId); err != nil {
+			return res, err
+		} else if res.State != InstanceState_processing {
+			return res, nil
+		}
+
+		if c.ctx == nil {
+			time.Sleep(interval)
+		} else {
+			select {
+			case <-c.ctx.Done():
+				return res, c.ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}
+}
+
+// The schema used by requests to deploy a new instance.
+const DeployInstanceRequestSchema = "http://elasticbox.net/schemas/deploy-instance-request"
+
+// DeployInstanceRequest is used to deploy a new instance.
+type DeployInstanceRequest struct {
+	// Request schema, DeployInstanceRequestSchema
+	Schema string `json:"schema"`
+
+	// Instance owner (workspace)
+	Owner string `json:"owner"`
+
+	// Instance name
+	Name string `json:"name"`
+
+	// Box (version) to deploy
+	Box DeployInstanceBox `json:"box"`
+
+	// Deployment policy box to use
+	PolicyBox DeployInstanceBox `json:"policy_box"`
+
+	// List of instance tags
+	Tags []string `json:"instance_tags"`
+
+	// Automatic updates: one of { "off", "major", "minor", "patch" }
+	AutomaticUpdates string `json:"automatic_updates,omitempty"`
+}
+
+// DeployInstanceBox references a box and its variables inside a DeployInstanceRequest.
+type DeployInstanceBox struct {
+	ID        uuid.UUID       `json:"id"`
+	Variables []BasicVariable `json:"variables"`
+}
+
+// CreateInstance deploys a new instance as specified by @req.
+func (c *Client) CreateInstance(req *DeployInstanceRequest) (res Instance, err error) {
+	if req == nil {
+		return res, errors.Errorf("attempt to deploy nil instance request")
+	} else if req.Schema == "" {
+		req.Schema = DeployInstanceRequestSchema
+	}
+	return res, c.getResponse("/services/instances", "POST", req, &res)
+}
+
+// UpdateInstance applies @changes to the definition of @instanceId, as stored by the server.
+// Since the Instance model does not cover all server fields, the raw definition is fetched and only
+// the fields in @changes are replaced; nested objects (e.g. "policy_box") are merged recursively.
+// It returns the updated instance on success. Changes take effect after reconfiguring the instance.
+func (c *Client) UpdateInstance(instanceId string, changes map[string]interface{}) (res Instance, err error) {
+	var raw map[string]interface{}
+
+	if instanceId == "" {
+		return res, errors.Errorf("attempt to update instance without ID")
+	} else if err := c.Get("/services/instances/"+instanceId, &raw); err != nil {
+		return res, errors.Wrapf(err, "failed to query instance %s", instanceId)
+	}
+	mergeJSON(raw, changes)
+	return res, c.getResponse("/services/instances/"+instanceId, "PUT", raw, &res)
+}
+
+// mergeJSON copies the fields of @src into @dst, merging objects that are present in both.
+func mergeJSON(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if s, ok := v.(map[string]interface{}); ok {
+			if d, ok := dst[k].(map[string]interface{}); ok {
+				mergeJSON(d, s)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
 // Service represents the service associated with an instance.
 type InstanceService struct {
 	ID           string        `json:"id"`           // e.g. "eb-e775t"
@@ -194,6 +318,68 @@ func (c *Client) GetInstanceService(instanceId string) (res InstanceService, err
 	return res, c.Get(fmt.Sprintf("/services/instances/%s/service", instanceId), &res)
 }
 
+// GetInstanceServices fetches the services of @instanceIds, using up to @parallel concurrent requests.
+// Returns the services and the errors encountered, both indexed by instance ID.
+func (c *Client) GetInstanceServices(instanceIds []string, parallel int) (map[string]InstanceService, map[string]error) {
+	var services = make(map[string]InstanceService)
+
+	errs := c.forEachID(instanceIds, parallel, func(instanceId string) (func(), error) {
+		srv, err := c.GetInstanceService(instanceId)
+		return func() { services[instanceId] = srv }, err
+	})
+	return services, errs
+}
+
+// GetAllInstanceOperations fetches the operations of @instanceIds, using up to @parallel concurrent requests.
+// Returns the operations and the errors encountered, both indexed by instance ID.
+func (c *Client) GetAllInstanceOperations(instanceIds []string, parallel int) (map[string][]InstanceOperation, map[string]error) {
+	var operations = make(map[string][]InstanceOperation)
+
+	errs := c.forEachID(instanceIds, parallel, func(instanceId string) (func(), error) {
+		ops, err := c.GetInstanceOperations(instanceId)
+		return func() { operations[instanceId] = ops }, err
+	})
+	return operations, errs
+}
+
+// forEachID runs @fetch for each of @ids, using up to @parallel goroutines.
+// On success, the function returned by @fetch is called under a lock, to store the result.
+// Returns the errors encountered, indexed by ID.
+func (c *Client) forEachID(ids []string, parallel int, fetch func(id string) (func(), error)) map[string]error {
+	var (
+		errs = make(map[string]error)
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	var sem = make(chan struct{}, parallel)
+
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			store, err := fetch(id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[id] = err
+			} else {
+				store()
+			}
+		}(id)
+	}
+	wg.Wait()
+	return errs
+}
+
 // InstanceActivity represents an activity log of an instance.
 type InstanceActivity struct {
 	Box       string    `json:"box"`        // e.g. "",
@@ -0,0 +1,266 @@
+package clccam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Lifespan Enforcement
+ *
+ * Instances live for a time-to-live (TTL), given by an instance tag (e.g. "ttl=72h"),
+ * or by the rules of a LifespanPolicy. Once expired, they are shut down or terminated.
+ */
+
+// Prefix of the instance tag that sets the TTL of an instance, e.g. "ttl=72h" or "ttl=never".
+const TTLTagPrefix = "ttl="
+
+const (
+	// The lifespan of an instance will expire soon.
+	WatchLifespanExpiring WatchEventType = "lifespan_expiring"
+
+	// The lifespan of an instance has expired.
+	WatchLifespanExpired WatchEventType = "lifespan_expired"
+)
+
+// LifespanPolicy determines the TTL of instances, and what happens when it expires.
+type LifespanPolicy struct {
+	// TTL of instances not matched by a tag or rule (e.g. "14d"); empty means unlimited.
+	DefaultTTL string `json:"default_ttl,omitempty"`
+
+	// Action on expiry: "shutdown" (default) or "terminate".
+	Action string `json:"action,omitempty"`
+
+	// Owners are warned this long before expiry (e.g. "24h").
+	WarnBefore string `json:"warn_before,omitempty"`
+
+	// Rules are evaluated in order; the first matching rule applies.
+	Rules []LifespanRule `json:"rules,omitempty"`
+}
+
+// LifespanRule sets the TTL of the instances it matches.
+type LifespanRule struct {
+	// Matches instances that have all of these tags (any instance if empty)
+	Tags []string `json:"tags,omitempty"`
+
+	// Matches instances of this owner (any owner if empty)
+	Owner string `json:"owner,omitempty"`
+
+	// TTL of matching instances (e.g. "72h", "7d" or "never")
+	TTL string `json:"ttl"`
+
+	// Action on expiry, overriding that of the policy
+	Action string `json:"action,omitempty"`
+}
+
+// LifespanStatus is the result of evaluating the lifespan of an instance.
+type LifespanStatus struct {
+	Instance string    `json:"instance"` // Instance ID
+	Name     string    `json:"name"`     // Instance name
+	Owner    string    `json:"owner"`    // Instance owner
+	Created  time.Time `json:"created"`  // Start of the lifespan
+
+	TTL     time.Duration `json:"ttl"`     // Time to live
+	Expires time.Time     `json:"expires"` // Time of expiry
+	Source  string        `json:"source"`  // Where @TTL came from: "tag", "rule #n" or "default"
+
+	// PlanPowerOff or PlanTerminate
+	Action PlanActionType `json:"action"`
+
+	Expired  bool `json:"expired"`  // Whether @Expires has passed
+	Expiring bool `json:"expiring"` // Whether @Expires is within the warning period
+}
+
+// Event returns the notification event corresponding to @s.
+// If @s is expired, the event reports that the lifespan action has been performed.
+func (s LifespanStatus) Event() WatchEvent {
+	var evt = WatchEvent{
+		Type:     WatchLifespanExpiring,
+		Time:     s.Expires,
+		Instance: s.Instance,
+		Name:     s.Name,
+		Owner:    s.Owner,
+		Text:     fmt.Sprintf("lifespan of %s expires %s, instance will be %s", s.TTL, s.Expires.Format(time.RFC1123), lifespanVerb(s.Action)),
+	}
+
+	if s.Expired {
+		evt.Type = WatchLifespanExpired
+		evt.Text = fmt.Sprintf("lifespan of %s expired %s, instance has been %s", s.TTL, s.Expires.Format(time.RFC1123), lifespanVerb(s.Action))
+	}
+	return evt
+}
+
+// lifespanVerb describes the outcome of @action.
+func lifespanVerb(action PlanActionType) string {
+	if action == PlanTerminate {
+		return "terminated"
+	}
+	return "shut down"
+}
+
+// LoadLifespanPolicy reads and validates the policy in @path. A missing file yields an empty policy,
+// in which only instances with a TTL tag have a limited lifespan.
+func LoadLifespanPolicy(path string) (*LifespanPolicy, error) {
+	var p LifespanPolicy
+
+	if content, err := ioutil.ReadFile(path); os.IsNotExist(err) {
+		return &p, nil
+	} else if err != nil {
+		return nil, errors.Errorf("unable to read lifespan policy: %s", err)
+	} else if err = yaml.Unmarshal(content, &p); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize lifespan policy %s", path)
+	} else if err = p.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid lifespan policy %s", path)
+	}
+	return &p, nil
+}
+
+// Validate checks the durations and actions of @p.
+func (p *LifespanPolicy) Validate() error {
+	if _, err := ParseTTL(p.DefaultTTL); err != nil && p.DefaultTTL != "" {
+		return errors.Wrapf(err, "invalid default_ttl")
+	} else if _, err := lifespanAction(p.Action); err != nil {
+		return err
+	} else if _, err := ParseTTL(p.WarnBefore); err != nil && p.WarnBefore != "" {
+		return errors.Wrapf(err, "invalid warn_before")
+	}
+
+	for i, r := range p.Rules {
+		if _, err := ParseTTL(r.TTL); err != nil {
+			return errors.Wrapf(err, "rule #%d: invalid ttl", i+1)
+		} else if _, err := lifespanAction(r.Action); err != nil {
+			return errors.Wrapf(err, "rule #%d", i+1)
+		}
+	}
+	return nil
+}
+
+// ParseTTL parses @s as duration, which may also be given in days (e.g. "7d"), or as "never" (0).
+func ParseTTL(s string) (time.Duration, error) {
+	switch {
+	case s == "never":
+		return 0, nil
+	case strings.HasSuffix(s, "d"):
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days <= 0 {
+			return 0, errors.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	} else if d <= 0 {
+		return 0, errors.Errorf("non-positive duration %q", s)
+	}
+	return d, nil
+}
+
+// lifespanAction maps the policy action @s to a PlanActionType.
+func lifespanAction(s string) (PlanActionType, error) {
+	switch s {
+	case "", "shutdown":
+		return PlanPowerOff, nil
+	case "terminate":
+		return PlanTerminate, nil
+	}
+	return "", errors.Errorf("invalid lifespan action %q (expecting shutdown or terminate)", s)
+}
+
+// Evaluate returns the lifespan status of @inst at @now. Returns false if @inst has an unlimited lifespan,
+// is terminated, or has nothing left to do (powered off, with shutdown as action).
+//
+// The TTL is taken from the instance tag, the first matching rule, or the default, in that order.
+// The action is taken from the lifespan of the instance box (if not "none"), the rule, or the policy.
+func (p *LifespanPolicy) Evaluate(inst *Instance, now time.Time) (s LifespanStatus, ok bool) {
+	var ttl, action = p.DefaultTTL, p.Action
+
+	if inst.IsTerminated() {
+		return s, false
+	}
+
+	s.Source = "default"
+	for i, r := range p.Rules {
+		if r.Owner != "" && r.Owner != inst.Owner {
+			continue
+		}
+		var match = true
+		for _, tag := range r.Tags {
+			match = match && inst.HasTag(tag)
+		}
+		if match {
+			ttl, s.Source = r.TTL, fmt.Sprintf("rule #%d", i+1)
+			if r.Action != "" {
+				action = r.Action
+			}
+			break
+		}
+	}
+
+	for _, tag := range inst.Tags {
+		if strings.HasPrefix(tag, TTLTagPrefix) {
+			ttl, s.Source = strings.TrimPrefix(tag, TTLTagPrefix), "tag"
+		}
+	}
+
+	for _, b := range inst.Boxes {
+		if b.ID == inst.Box && b.Lifespan != nil {
+			switch b.Lifespan.Operation {
+			case "shutdown", "terminate":
+				action = b.Lifespan.Operation
+			}
+		}
+	}
+
+	d, err := ParseTTL(ttl)
+	if ttl == "" || err != nil || d == 0 {
+		return s, false
+	}
+
+	s.Action, _ = lifespanAction(action)
+	if s.Action == PlanPowerOff && !inst.PoweredOn() {
+		return s, false
+	}
+
+	s.Instance, s.Name, s.Owner = inst.ID, inst.Name, inst.Owner
+	s.Created, s.TTL = inst.Created.Time, d
+	s.Expires = s.Created.Add(d)
+	s.Expired = !now.Before(s.Expires)
+
+	if warn, err := ParseTTL(p.WarnBefore); err == nil && !s.Expired {
+		s.Expiring = now.Add(warn).After(s.Expires)
+	}
+	return s, true
+}
+
+// EnforceLifespan shuts down or terminates the instance of @s, unless it is in the middle of an operation,
+// or already powered off. Returns a non-empty reason if the instance was skipped.
+func (c *Client) EnforceLifespan(s LifespanStatus) (skipped string, err error) {
+	inst, err := c.GetInstance(s.Instance)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to query instance %s", s.Instance)
+	} else if inst.IsTerminated() {
+		return "instance is terminated", nil
+	} else if inst.State == InstanceState_processing {
+		return "instance is processing " + inst.Operation.Event.String(), nil
+	}
+
+	switch s.Action {
+	case PlanPowerOff:
+		if !inst.PoweredOn() {
+			return "instance is already powered off", nil
+		}
+		return "", c.ShutdownInstance(s.Instance)
+	case PlanTerminate:
+		return "", c.DeleteInstance(s.Instance, "terminate")
+	}
+	return "", errors.Errorf("unsupported lifespan action %q", s.Action)
+}
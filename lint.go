@@ -0,0 +1,336 @@
+package clccam
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+/*
+ * Box Directory Linter
+ *
+ * Validates a box directory (see BoxFileName and the Box*Dir constants) before it is uploaded.
+ */
+
+// Maximum size of a box icon.
+const MaxIconSize = 1 << 20
+
+// Valid names of box variables.
+var boxVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LintSeverity classifies a LintIssue.
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"   // the box can not be imported as is
+	LintWarning LintSeverity = "warning" // the box can be imported, but is probably not what was intended
+)
+
+// LintIssue is a single problem found in a box directory.
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	File     string       `json:"file"` // path relative to the box directory
+	Message  string       `json:"message"`
+}
+
+func (l LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", l.File, l.Severity, l.Message)
+}
+
+// LintIssues is the result of linting a box directory.
+type LintIssues []LintIssue
+
+// Errors returns the number of errors in @l.
+func (l LintIssues) Errors() (n int) {
+	for _, issue := range l {
+		if issue.Severity == LintError {
+			n++
+		}
+	}
+	return n
+}
+
+// add appends an issue to @l.
+func (l *LintIssues) add(severity LintSeverity, file, format string, a ...interface{}) {
+	*l = append(*l, LintIssue{Severity: severity, File: file, Message: fmt.Sprintf(format, a...)})
+}
+
+// LintBoxDir validates the box directory @dir.
+func LintBoxDir(dir string) (issues LintIssues) {
+	var (
+		box Box
+		raw map[string]interface{}
+	)
+
+	// Sometimes a 'draft' directory is inserted between the directory and its contents.
+	if _, err := os.Stat(path.Join(dir, "draft", BoxFileName)); err == nil {
+		dir = path.Join(dir, "draft")
+	}
+
+	content, err := ioutil.ReadFile(path.Join(dir, BoxFileName))
+	if err != nil {
+		issues.add(LintError, BoxFileName, "unable to read: %s", err)
+		return issues
+	}
+
+	// 1. Structure of box.yaml
+	if j, err := yaml.YAMLToJSON(content); err != nil {
+		issues.add(LintError, BoxFileName, "invalid YAML: %s", err)
+		return issues
+	} else if err := json.Unmarshal(j, &raw); err != nil {
+		issues.add(LintError, BoxFileName, "not a YAML mapping: %s", err)
+		return issues
+	}
+
+	var (
+		known   = jsonFieldNames(reflect.TypeOf(box))
+		unknown []string
+	)
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		issues.add(LintError, BoxFileName, "unknown key %q", key)
+	}
+
+	if err := yaml.Unmarshal(content, &box); err != nil {
+		issues.add(LintError, BoxFileName, "does not match the box model: %s", err)
+		return issues
+	}
+
+	// 2. Schema
+	var schema = box.Schema.String()
+	if schema == "" {
+		schema = ScriptBoxSchema
+		issues.add(LintWarning, BoxFileName, "no schema, assuming %s", ScriptBoxSchema)
+	} else if !stringInSlice(schema, BoxSchemas) {
+		issues.add(LintError, BoxFileName, "unknown schema %q", schema)
+	}
+	if box.Name == "" {
+		issues.add(LintError, BoxFileName, "missing box name")
+	}
+
+	// 3. Variables
+	lintVariables(&issues, dir, box.Variables)
+
+	// 4. Requirements and claims
+	lintTags(&issues, "requirements", box.Requirements)
+	lintTags(&issues, "claims", box.Claims)
+	for _, r := range box.Requirements {
+		if stringInSlice(r, box.Claims) {
+			issues.add(LintWarning, BoxFileName, "%q is both required and claimed", r)
+		}
+	}
+	if schema == PolicyBoxSchema && len(box.Claims) == 0 {
+		issues.add(LintWarning, BoxFileName, "policy box without claims can not satisfy any requirements")
+	}
+
+	// 5. Events
+	lintEvents(&issues, dir, schema == ScriptBoxSchema)
+
+	// 6. Icon
+	if m := box.IconMetadata; m != nil && !m.Image.IsZero() {
+		if p := m.Image.Path; !IsBlobURL(m.Image.String()) && !strings.HasPrefix(p, "images/") {
+			lintIcon(&issues, dir, p)
+		}
+	} else if box.Icon != "" && !IsBlobURL(box.Icon) {
+		lintIcon(&issues, dir, box.Icon)
+	}
+
+	// 7. Template
+	if t := box.Template; t != nil && !t.Url.IsZero() && !IsBlobURL(t.Url.String()) {
+		if _, err := os.Stat(path.Join(dir, t.Url.Path)); err != nil {
+			issues.add(LintError, t.Url.Path, "template file: %s", err)
+		}
+	} else if schema == CloudFormationBoxSchema {
+		issues.add(LintWarning, BoxFileName, "CloudFormation box without template")
+	}
+
+	// 8. Readme
+	if _, err := os.Stat(path.Join(dir, ReadmeName)); err != nil {
+		issues.add(LintWarning, ReadmeName, "missing readme")
+	}
+	return issues
+}
+
+// lintVariables checks the box @variables, resolving File variables relative to @dir.
+func lintVariables(issues *LintIssues, dir string, variables []BoxVariable) {
+	var seen = make(map[string]bool)
+
+	for i, v := range variables {
+		var where = fmt.Sprintf("variable %q", v.Name)
+
+		if v.Name == "" {
+			where = fmt.Sprintf("variable #%d", i+1)
+			issues.add(LintError, BoxFileName, "%s: missing name", where)
+		} else if !boxVariableName.MatchString(v.Name) {
+			issues.add(LintError, BoxFileName, "%s: invalid name (letters, digits and '_' only)", where)
+		} else if seen[v.Name] {
+			issues.add(LintError, BoxFileName, "%s: duplicate name", where)
+		}
+		seen[v.Name] = true
+
+		if !stringInSlice(v.Type, BoxVariableTypes) {
+			issues.add(LintError, BoxFileName, "%s: unknown type %q (expecting one of %s)", where, v.Type, strings.Join(BoxVariableTypes, ", "))
+			continue
+		}
+		if err := CheckVariableValue(&v); err != nil {
+			issues.add(LintError, BoxFileName, "%s: %s", where, err)
+		}
+		if v.Required && v.Value == "" && v.Visibility != Visibility_Public {
+			issues.add(LintWarning, BoxFileName, "%s: required, but neither set nor visible to the deployer", where)
+		}
+
+		if v.Type == "File" && v.Value != "" && !IsBlobURL(v.Value) {
+			if fi, err := os.Stat(path.Join(dir, v.Value)); err != nil {
+				issues.add(LintError, v.Value, "%s: %s", where, err)
+			} else if fi.IsDir() {
+				issues.add(LintError, v.Value, "%s: is a directory", where)
+			} else if fi.Size() == 0 {
+				issues.add(LintError, v.Value, "%s: empty file can not be uploaded", where)
+			}
+		}
+	}
+}
+
+// CheckVariableValue performs type-specific validation of the value of @v.
+func CheckVariableValue(v *BoxVariable) error {
+	if v.Value == "" {
+		return nil
+	}
+
+	switch v.Type {
+	case "Port":
+		if n, err := strconv.Atoi(v.Value); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", v.Value)
+		}
+	case "Number":
+		if _, err := strconv.ParseFloat(v.Value, 64); err != nil {
+			return fmt.Errorf("invalid number %q", v.Value)
+		}
+	case "Options":
+		if v.Options == "" {
+			return fmt.Errorf("no options defined")
+		} else if !stringInSlice(v.Value, strings.Split(v.Options, ",")) {
+			return fmt.Errorf("value %q is not one of the options %q", v.Value, v.Options)
+		}
+	}
+	return nil
+}
+
+// lintTags checks the requirement or claim tags in @tags.
+func lintTags(issues *LintIssues, field string, tags []string) {
+	var seen = make(map[string]bool)
+
+	for _, t := range tags {
+		if strings.TrimSpace(t) == "" {
+			issues.add(LintError, BoxFileName, "%s: empty entry", field)
+		} else if seen[t] {
+			issues.add(LintWarning, BoxFileName, "%s: duplicate entry %q", field, t)
+		}
+		seen[t] = true
+	}
+}
+
+// lintEvents checks the event scripts in @dir; @scriptBox indicates whether the box uses events.
+func lintEvents(issues *LintIssues, dir string, scriptBox bool) {
+	files, err := ioutil.ReadDir(path.Join(dir, BoxEventsDir))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			issues.add(LintError, BoxEventsDir, "%s", err)
+		}
+		return
+	} else if !scriptBox && len(files) > 0 {
+		issues.add(LintWarning, BoxEventsDir, "events are only used by script boxes, and will be ignored")
+		return
+	}
+
+	for _, fi := range files {
+		var rel = path.Join(BoxEventsDir, fi.Name())
+
+		if fi.IsDir() {
+			issues.add(LintWarning, rel, "unexpected directory")
+			continue
+		} else if _, err := BoxEventFromString(fi.Name()); err != nil {
+			issues.add(LintError, rel, "not a valid event name (expecting one of %s)", strings.Join(BoxEventStrings(), ", "))
+			continue
+		}
+
+		b, err := ioutil.ReadFile(path.Join(dir, rel))
+		if err != nil {
+			issues.add(LintError, rel, "%s", err)
+			continue
+		} else if len(b) == 0 {
+			issues.add(LintError, rel, "empty event script")
+			continue
+		}
+		if !bytes.HasPrefix(b, []byte("#!")) {
+			issues.add(LintWarning, rel, "missing shebang line (e.g. #!/bin/bash)")
+		}
+		if bytes.Contains(b, []byte("\r\n")) {
+			issues.add(LintError, rel, "CRLF line endings")
+		}
+	}
+}
+
+// lintIcon checks the icon file at @rel (relative to @dir).
+func lintIcon(issues *LintIssues, dir, rel string) {
+	b, err := ioutil.ReadFile(path.Join(dir, rel))
+	if err != nil {
+		issues.add(LintError, rel, "icon: %s", err)
+		return
+	} else if len(b) > MaxIconSize {
+		issues.add(LintError, rel, "icon is too large (%d bytes, maximum is %d)", len(b), MaxIconSize)
+	}
+
+	switch ct := http.DetectContentType(b); {
+	case ct == "image/png", ct == "image/jpeg", ct == "image/gif":
+	case strings.HasSuffix(strings.ToLower(rel), ".svg") && bytes.Contains(b, []byte("<svg")):
+	default:
+		issues.add(LintError, rel, "unsupported icon type %s (expecting PNG, JPEG, GIF or SVG)", ct)
+	}
+}
+
+// jsonFieldNames returns the JSON names of the fields of the struct type @t.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	var res = make(map[string]bool)
+
+	for i := 0; i < t.NumField(); i++ {
+		var f = t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name := range jsonFieldNames(f.Type) {
+				res[name] = true
+			}
+		} else if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			res[name] = true
+		} else if name == "" {
+			res[f.Name] = true
+		}
+	}
+	return res
+}
+
+// stringInSlice returns true if @s is an element of @list.
+func stringInSlice(s string, list []string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
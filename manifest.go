@@ -0,0 +1,515 @@
+package clccam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+ * Instance Manifests
+ *
+ * A manifest describes the desired state of a set of instances. It can be kept in version control
+ * and compared against the actual CAM state, resulting in a plan of actions that reconcile both.
+ */
+
+// The tag used to mark instances as managed by a manifest, unless overridden by Manifest.ManagedTag.
+const DefaultManagedTag = "camsole-managed"
+
+// Polling interval while waiting for a new instance to deploy before powering it off.
+const deployPollInterval = 15 * time.Second
+
+// Manifest describes the desired state of a set of instances.
+type Manifest struct {
+	// Default owner (workspace) of the instances. Defaults to the token subject.
+	Owner string `json:"owner,omitempty"`
+
+	// Tag that is added to each manifest instance, to identify instances managed by a manifest.
+	ManagedTag string `json:"managed_tag,omitempty"`
+
+	// Desired instances
+	Instances []ManifestInstance `json:"instances"`
+}
+
+// ManifestInstance describes the desired state of a single instance.
+type ManifestInstance struct {
+	// Instance name, used to identify the instance.
+	Name string `json:"name"`
+
+	// Instance owner (workspace), overrides Manifest.Owner
+	Owner string `json:"owner,omitempty"`
+
+	// Box to deploy.
+	Box uuid.UUID `json:"box"`
+
+	// Version of @Box to deploy (e.g. "1.2.0"). If empty, any version of @Box is accepted.
+	Version string `json:"version,omitempty"`
+
+	// Deployment policy box.
+	PolicyBox uuid.UUID `json:"policy_box"`
+
+	// Values of box variables, indexed by variable name.
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Instance tags (in addition to the managed tag).
+	Tags []string `json:"tags,omitempty"`
+
+	// Desired power state: one of "on", "off" or empty (do not care).
+	PowerState string `json:"power_state,omitempty"`
+
+	// Automatic updates: one of { "off", "major", "minor", "patch" }, or empty (do not care).
+	AutomaticUpdates string `json:"automatic_updates,omitempty"`
+}
+
+// LoadManifest reads and validates the YAML manifest stored at @path.
+func LoadManifest(path string) (*Manifest, error) {
+	var m Manifest
+
+	if content, err := ioutil.ReadFile(path); err != nil {
+		return nil, errors.Errorf("unable to read manifest: %s", err)
+	} else if err = yaml.Unmarshal(content, &m); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize manifest %s", path)
+	} else if err = m.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", path)
+	}
+	if m.ManagedTag == "" {
+		m.ManagedTag = DefaultManagedTag
+	}
+	return &m, nil
+}
+
+// Validate performs basic consistency checks on @m.
+func (m *Manifest) Validate() error {
+	var seen = make(map[string]bool)
+
+	for i, inst := range m.Instances {
+		var key = inst.Owner + "/" + inst.Name
+
+		if inst.Owner == "" {
+			key = m.Owner + "/" + inst.Name
+		}
+
+		if inst.Name == "" {
+			return errors.Errorf("instance #%d: missing name", i+1)
+		} else if seen[key] {
+			return errors.Errorf("instance %s: duplicate name", inst.Name)
+		} else if uuid.Equal(uuid.Nil, inst.Box) {
+			return errors.Errorf("instance %s: missing box ID", inst.Name)
+		} else if uuid.Equal(uuid.Nil, inst.PolicyBox) {
+			return errors.Errorf("instance %s: missing policy box ID", inst.Name)
+		}
+		switch inst.PowerState {
+		case "", "on", "off":
+		default:
+			return errors.Errorf("instance %s: invalid power state %q", inst.Name, inst.PowerState)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// PlanActionType identifies the kind of action that a PlanAction performs.
+type PlanActionType string
+
+const (
+	PlanCreate    PlanActionType = "create"
+	PlanUpdate    PlanActionType = "update"
+	PlanPowerOn   PlanActionType = "power-on"
+	PlanPowerOff  PlanActionType = "power-off"
+	PlanTerminate PlanActionType = "terminate"
+)
+
+// PlanAction is a single step needed to reconcile the actual state with the manifest.
+type PlanAction struct {
+	// Kind of action
+	Type PlanActionType
+
+	// Name of the instance
+	Name string
+
+	// Existing instance (nil when creating a new instance).
+	Instance *Instance
+
+	// Human-readable list of changes.
+	Changes []string
+
+	// Request used by PlanCreate
+	deploy *DeployInstanceRequest
+
+	// Whether PlanCreate powers off the new instance once it is deployed
+	powerOff bool
+
+	// Changed instance fields used by PlanUpdate (see UpdateInstance)
+	update map[string]interface{}
+}
+
+func (a PlanAction) String() string {
+	var id = "(new)"
+
+	if a.Instance != nil {
+		id = a.Instance.ID
+	}
+	if len(a.Changes) == 0 {
+		return fmt.Sprintf("%s %s %s", a.Type, a.Name, id)
+	}
+	return fmt.Sprintf("%s %s %s: %s", a.Type, a.Name, id, strings.Join(a.Changes, "; "))
+}
+
+// PlanManifest compares @m against the existing instances and returns the list of actions needed.
+// @prune: terminate instances carrying the managed tag that are not part of @m, within the owners used by @m.
+func (c *Client) PlanManifest(m *Manifest, prune bool) (plan []PlanAction, err error) {
+	var (
+		managed  = make(map[string]bool)       // IDs of instances matched by @m
+		versions = make(map[string][]Box)      // versions of each box, indexed by box ID
+		boxes    = make(map[string]Box)        // box (version) details, indexed by box ID
+		owner    = m.Owner                     // default owner
+		existing = make(map[string][]Instance) // non-terminated instances, indexed by owner/name
+		seen     = make(map[string]bool)       // owner/name of the manifest instances
+		owners   = make(map[string]bool)       // owners of the manifest instances, limits pruning
+	)
+
+	if owner == "" {
+		if owner, err = c.GetTokenSubject(); err != nil {
+			return nil, errors.Wrapf(err, "unable to determine default owner")
+		}
+	}
+
+	instances, err := c.GetInstances()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query instances")
+	}
+	for _, i := range instances {
+		if !i.IsTerminated() {
+			existing[i.Owner+"/"+i.Name] = append(existing[i.Owner+"/"+i.Name], i)
+		}
+	}
+
+	for _, desired := range m.Instances {
+		var (
+			instOwner = desired.Owner
+			boxId     = desired.Box.String()
+			targetId  = desired.Box // box (version) ID to deploy
+			box       Box
+		)
+
+		if instOwner == "" {
+			instOwner = owner
+		}
+
+		// Validate can not detect duplicates involving the token subject as default owner.
+		if seen[instOwner+"/"+desired.Name] {
+			return nil, errors.Errorf("instance %s: duplicate name", desired.Name)
+		}
+		seen[instOwner+"/"+desired.Name] = true
+		owners[instOwner] = true
+
+		// Draft boxes may not have any versions, hence ignore the error unless a version is required.
+		if _, ok := versions[boxId]; !ok {
+			res, err := c.GetBoxVersions(boxId)
+			if err != nil && desired.Version != "" {
+				return nil, errors.Wrapf(err, "%s: failed to query versions of box %s", desired.Name, boxId)
+			}
+			versions[boxId] = res
+		}
+		if desired.Version != "" {
+			v, err := FindBoxVersion(versions[boxId], desired.Version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: box %s", desired.Name, boxId)
+			}
+			targetId = v.ID
+		}
+
+		if b, ok := boxes[targetId.String()]; ok {
+			box = b
+		} else if box, err = c.GetBox(targetId.String()); err != nil {
+			return nil, errors.Wrapf(err, "%s: failed to query box %s", desired.Name, targetId)
+		} else {
+			boxes[targetId.String()] = box
+		}
+
+		matches := existing[instOwner+"/"+desired.Name]
+		if len(matches) > 1 {
+			return nil, errors.Errorf("%s: name matches %d instances of %s", desired.Name, len(matches), instOwner)
+		} else if len(matches) == 0 {
+			action, err := planCreate(&desired, instOwner, m.ManagedTag, targetId, &box)
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, action)
+			continue
+		}
+
+		// Use the full instance details, the instance list may be abbreviated.
+		inst, err := c.GetInstance(matches[0].ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: failed to query instance %s", desired.Name, matches[0].ID)
+		}
+		managed[inst.ID] = true
+
+		if action, err := planUpdate(&desired, &inst, m.ManagedTag, targetId, versions[boxId], &box); err != nil {
+			return nil, err
+		} else if len(action.Changes) > 0 {
+			plan = append(plan, action)
+		}
+
+		if desired.PowerState == "on" && !inst.PoweredOn() {
+			plan = append(plan, PlanAction{Type: PlanPowerOn, Name: inst.Name, Instance: &inst})
+		} else if desired.PowerState == "off" && inst.PoweredOn() {
+			plan = append(plan, PlanAction{Type: PlanPowerOff, Name: inst.Name, Instance: &inst})
+		}
+	}
+
+	// Only prune within the workspaces of the manifest, since other manifests may use the same managed tag.
+	if prune {
+		var unmanaged []PlanAction
+
+		owners[owner] = true
+
+		for _, same := range existing {
+			for i := range same {
+				if inst := same[i]; inst.HasTag(m.ManagedTag) && owners[inst.Owner] && !managed[inst.ID] {
+					unmanaged = append(unmanaged, PlanAction{
+						Type:     PlanTerminate,
+						Name:     inst.Name,
+						Instance: &inst,
+						Changes:  []string{"not in manifest"},
+					})
+				}
+			}
+		}
+		sort.Slice(unmanaged, func(i, j int) bool {
+			return unmanaged[i].Name < unmanaged[j].Name
+		})
+		plan = append(plan, unmanaged...)
+	}
+	return plan, nil
+}
+
+// planCreate returns the action to deploy @desired as a new instance of box (version) @boxId.
+func planCreate(desired *ManifestInstance, owner, managedTag string, boxId uuid.UUID, box *Box) (PlanAction, error) {
+	var req = &DeployInstanceRequest{
+		Schema:           DeployInstanceRequestSchema,
+		Owner:            owner,
+		Name:             desired.Name,
+		Box:              DeployInstanceBox{ID: boxId, Variables: []BasicVariable{}},
+		PolicyBox:        DeployInstanceBox{ID: desired.PolicyBox, Variables: []BasicVariable{}},
+		Tags:             mergeTags(desired.Tags, managedTag),
+		AutomaticUpdates: desired.AutomaticUpdates,
+	}
+	var changes = []string{fmt.Sprintf("box %s", boxId)}
+
+	if desired.Version != "" {
+		changes[0] += " version " + desired.Version
+	}
+
+	for _, name := range sortedKeys(desired.Variables) {
+		v, ok := findBoxVariable(box, name)
+		if !ok {
+			return PlanAction{}, errors.Errorf("%s: box %s has no variable %q", desired.Name, boxId, name)
+		}
+		req.Box.Variables = append(req.Box.Variables, BasicVariable{Name: name, Type: v.Type, Value: desired.Variables[name]})
+	}
+	if desired.PowerState == "off" {
+		changes = append(changes, "power-off after deploy")
+	}
+	return PlanAction{Type: PlanCreate, Name: desired.Name, Changes: changes, deploy: req, powerOff: desired.PowerState == "off"}, nil
+}
+
+// planUpdate returns the action to update @inst to match @desired, with an empty Changes list if up to date.
+// @boxId:    target box (version) ID
+// @versions: known versions of the manifest box
+func planUpdate(desired *ManifestInstance, inst *Instance, managedTag string, boxId uuid.UUID, versions []Box, box *Box) (PlanAction, error) {
+	var (
+		action  = PlanAction{Type: PlanUpdate, Name: inst.Name, Instance: inst, update: make(map[string]interface{})}
+		updated Instance // holds the updated variables
+		tags    = mergeTags(desired.Tags, managedTag)
+	)
+
+	// Box: without an explicit version, accept any version of the manifest box.
+	if !uuid.Equal(inst.Box, boxId) {
+		var anyVersion = desired.Version == "" && uuid.Equal(inst.Box, desired.Box)
+
+		if desired.Version == "" {
+			for _, v := range versions {
+				anyVersion = anyVersion || uuid.Equal(inst.Box, v.ID)
+			}
+		}
+		if !anyVersion {
+			action.Changes = append(action.Changes, fmt.Sprintf("box %s => %s", inst.Box, boxId))
+			action.update["box"] = boxId.String()
+		}
+	}
+
+	if !uuid.Equal(inst.PolicyBox.ID, desired.PolicyBox) {
+		action.Changes = append(action.Changes, fmt.Sprintf("policy box %s => %s", inst.PolicyBox.ID, desired.PolicyBox))
+		action.update["policy_box"] = map[string]interface{}{"id": desired.PolicyBox.String()}
+	}
+
+	if !sameTags(inst.Tags, tags) {
+		action.Changes = append(action.Changes, fmt.Sprintf("tags [%s] => [%s]",
+			strings.Join(inst.Tags, ", "), strings.Join(tags, ", ")))
+		action.update["tags"] = tags
+	}
+
+	if desired.AutomaticUpdates != "" && desired.AutomaticUpdates != inst.AutomaticUpdates {
+		action.Changes = append(action.Changes, fmt.Sprintf("automatic updates %q => %q",
+			inst.AutomaticUpdates, desired.AutomaticUpdates))
+		action.update["automatic_updates"] = desired.AutomaticUpdates
+	}
+
+	// Variables: copy, since the entries are modified in place.
+	updated.Variables = make([]interface{}, 0, len(inst.Variables))
+	for _, v := range inst.Variables {
+		if m, ok := v.(map[string]interface{}); ok {
+			var c = make(map[string]interface{}, len(m))
+
+			for k, val := range m {
+				c[k] = val
+			}
+			v = c
+		}
+		updated.Variables = append(updated.Variables, v)
+	}
+
+	var changed = len(action.Changes)
+
+	for _, name := range sortedKeys(desired.Variables) {
+		var value = desired.Variables[name]
+
+		if v, ok := instanceVariable(&updated, name); ok {
+			if cur := fmt.Sprint(v["value"]); cur != value {
+				action.Changes = append(action.Changes, fmt.Sprintf("variable %s %q => %q", name, cur, value))
+				v["value"] = value
+			}
+		} else if bv, ok := findBoxVariable(box, name); !ok {
+			return action, errors.Errorf("%s: box %s has no variable %q", desired.Name, boxId, name)
+		} else {
+			action.Changes = append(action.Changes, fmt.Sprintf("variable %s %q => %q", name, bv.Value, value))
+			updated.Variables = append(updated.Variables, map[string]interface{}{
+				"name":  name,
+				"type":  bv.Type,
+				"value": value,
+			})
+		}
+	}
+
+	if len(action.Changes) > changed {
+		action.update["variables"] = updated.Variables
+	}
+	return action, nil
+}
+
+// ApplyPlanAction performs the single action @a.
+// It returns the ID of the instance that @a affected.
+func (c *Client) ApplyPlanAction(a PlanAction) (instanceId string, err error) {
+	if a.Instance != nil {
+		instanceId = a.Instance.ID
+	}
+
+	switch a.Type {
+	case PlanCreate:
+		if a.deploy == nil {
+			return "", errors.Errorf("%s: missing deploy request", a.Name)
+		}
+		res, err := c.CreateInstance(a.deploy)
+		if err != nil || !a.powerOff {
+			return res.ID, err
+		}
+
+		// The instance can only be powered off once it has been deployed.
+		// Give the server time to register the deployment before polling the instance state.
+		time.Sleep(deployPollInterval)
+		if inst, err := c.WaitForInstance(res.ID, deployPollInterval); err != nil {
+			return res.ID, errors.Wrapf(err, "failed to wait for %s", res.ID)
+		} else if inst.State == InstanceState_unavailable {
+			return res.ID, errors.Errorf("deployment of %s failed: instance is %s", res.ID, inst.State)
+		}
+		return res.ID, c.ShutdownInstance(res.ID)
+	case PlanUpdate:
+		if a.update == nil {
+			return instanceId, errors.Errorf("%s: missing instance update", a.Name)
+		} else if _, err := c.UpdateInstance(instanceId, a.update); err != nil {
+			return instanceId, errors.Wrapf(err, "failed to update %s", instanceId)
+		}
+		return instanceId, c.ReconfigureInstance(instanceId)
+	case PlanPowerOn:
+		return instanceId, c.PowerOnInstance(instanceId)
+	case PlanPowerOff:
+		return instanceId, c.ShutdownInstance(instanceId)
+	case PlanTerminate:
+		return instanceId, c.DeleteInstance(instanceId, "terminate")
+	}
+	return instanceId, errors.Errorf("invalid plan action %q", a.Type)
+}
+
+// instanceVariable returns the variable @name of @i, if present.
+// Variables with a scope (variables of a service box) can be referenced as "scope.name".
+func instanceVariable(i *Instance, name string) (map[string]interface{}, bool) {
+	for _, v := range i.Variables {
+		if m, ok := v.(map[string]interface{}); ok {
+			var varName = fmt.Sprint(m["name"])
+
+			if scope, ok := m["scope"].(string); ok && scope != "" {
+				varName = scope + "." + varName
+			}
+			if varName == name {
+				return m, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// findBoxVariable returns the variable @name of @box, if present.
+func findBoxVariable(box *Box, name string) (BoxVariable, bool) {
+	for _, v := range box.Variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return BoxVariable{}, false
+}
+
+// mergeTags returns the sorted union of @tags and @extra.
+func mergeTags(tags []string, extra ...string) (res []string) {
+	var seen = make(map[string]bool)
+
+	for _, t := range append(append([]string{}, tags...), extra...) {
+		if t != "" && !seen[t] {
+			res = append(res, t)
+			seen[t] = true
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// sameTags returns true if @a and @b contain the same set of tags.
+func sameTags(a, b []string) bool {
+	var x, y = mergeTags(a), mergeTags(b)
+
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of @m in sorted order.
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
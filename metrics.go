@@ -0,0 +1,220 @@
+package clccam
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Metrics
+ *
+ * Records API call counts, errors and latencies at the client transport, and renders
+ * metrics in the Prometheus text exposition format.
+ */
+
+// Escaping of HELP text and label values in the exposition format.
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// MetricSample is a single value of a metric, with its label name/value pairs.
+type MetricSample struct {
+	// Alternating label names and values, e.g. {"state", "done", "owner", "jdoe"}
+	Labels []string
+
+	// Sample value
+	Value float64
+}
+
+// WriteMetric writes the metric @name of type @kind ("gauge", "counter", ...) with @samples to @w.
+func WriteMetric(w io.Writer, name, help, kind string, samples ...MetricSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+
+	for _, s := range samples {
+		writeSample(w, name, s)
+	}
+}
+
+// WriteSummary writes the summary @name, consisting of @sums and @counts (with matching labels), to @w.
+func WriteSummary(w io.Writer, name, help string, sums, counts []MetricSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+
+	for _, s := range sums {
+		writeSample(w, name+"_sum", s)
+	}
+	for _, s := range counts {
+		writeSample(w, name+"_count", s)
+	}
+}
+
+// writeSample writes the single sample @s of metric @name to @w.
+func writeSample(w io.Writer, name string, s MetricSample) {
+	var labels []string
+
+	for i := 0; i+1 < len(s.Labels); i += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, s.Labels[i], labelEscaper.Replace(s.Labels[i+1])))
+	}
+	if len(labels) > 0 {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(labels, ","), formatMetricValue(s.Value))
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, formatMetricValue(s.Value))
+	}
+}
+
+// formatMetricValue formats @v as required by the exposition format.
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// APIMetrics records the API calls made by a client. Enable it via the Metrics() client option.
+type APIMetrics struct {
+	mu    sync.Mutex
+	calls map[apiCall]*apiCallStats
+}
+
+// apiCall identifies the calls counted together.
+type apiCall struct {
+	method   string
+	endpoint string
+}
+
+// apiCallStats accumulates the results of an apiCall.
+type apiCallStats struct {
+	codes   map[int]uint64 // number of responses, by HTTP status code
+	errors  uint64         // number of requests that failed with a transport error or status >= 400
+	seconds float64        // sum of request latencies
+	count   uint64         // number of requests
+}
+
+// NewAPIMetrics returns an empty set of API call metrics.
+func NewAPIMetrics() *APIMetrics {
+	return &APIMetrics{calls: make(map[apiCall]*apiCallStats)}
+}
+
+// Metrics records the requests of the client in @m.
+// Apply after Retryer() to count each API call once, or before to count individual attempts.
+func Metrics(m *APIMetrics) ClientOption {
+	return func(r *Client) {
+		r.client.Transport = &metricsTransport{next: r.client.Transport, metrics: m}
+	}
+}
+
+// metricsTransport wraps an http.RoundTripper to record its requests.
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics *APIMetrics
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var start = time.Now()
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.metrics.record(req.Method, req.URL.Path, 0, time.Since(start))
+	} else {
+		t.metrics.record(req.Method, req.URL.Path, res.StatusCode, time.Since(start))
+	}
+	return res, err
+}
+
+// record adds a call of @method on @path that returned @code (0 if failed) after @latency.
+func (m *APIMetrics) record(method, path string, code int, latency time.Duration) {
+	var key = apiCall{method: method, endpoint: apiEndpoint(path)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.calls[key]
+	if !ok {
+		stats = &apiCallStats{codes: make(map[int]uint64)}
+		m.calls[key] = stats
+	}
+	stats.count++
+	stats.seconds += latency.Seconds()
+	if code > 0 {
+		stats.codes[code]++
+	}
+	if code == 0 || code >= 400 {
+		stats.errors++
+	}
+}
+
+// apiEndpoint reduces @path to an endpoint template, replacing resource IDs by "{id}",
+// to keep the number of label values bounded.
+func apiEndpoint(path string) string {
+	var segments = strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, s := range segments {
+		if strings.IndexFunc(s, func(r rune) bool { return (r < 'a' || r > 'z') && r != '_' }) >= 0 {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// WriteMetrics writes the recorded API call metrics to @w.
+func (m *APIMetrics) WriteMetrics(w io.Writer) {
+	var (
+		keys                      []apiCall
+		requests, errs, durations []MetricSample
+		counts                    []MetricSample
+	)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.calls {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	for _, key := range keys {
+		var (
+			stats  = m.calls[key]
+			labels = []string{"method", key.method, "endpoint", key.endpoint}
+			codes  []int
+		)
+
+		for code := range stats.codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			requests = append(requests, MetricSample{
+				Labels: append(labels[:4:4], "code", strconv.Itoa(code)),
+				Value:  float64(stats.codes[code]),
+			})
+		}
+		errs = append(errs, MetricSample{Labels: labels, Value: float64(stats.errors)})
+		durations = append(durations, MetricSample{Labels: labels, Value: stats.seconds})
+		counts = append(counts, MetricSample{Labels: labels, Value: float64(stats.count)})
+	}
+
+	WriteMetric(w, "cam_api_requests_total", "Number of CAM API responses, by status code.", "counter", requests...)
+	WriteMetric(w, "cam_api_request_errors_total", "Number of CAM API requests that failed or returned an error status.", "counter", errs...)
+	WriteSummary(w, "cam_api_request_duration_seconds", "Latency of CAM API requests.", durations, counts)
+}
@@ -0,0 +1,216 @@
+package clccam
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Instance Migration
+ *
+ * A migration is run as a sequence of instance operations (stages):
+ * 1. prepare_migration: set up the migration infrastructure (VMs, PGs etc),
+ * 2. test_migration:    perform a test-failover,
+ * 3. run_migration:     perform the actual migration,
+ * 4. cleanup_migration: remove the migration infrastructure.
+ * The test-failover stage is optional. A failed stage can be re-tried via retry_migration.
+ */
+
+// MigrationStages lists the migration stages in the order in which they have to be run.
+var MigrationStages = []InstanceOp{
+	InstanceOp_prepare_migration,
+	InstanceOp_test_migration,
+	InstanceOp_run_migration,
+	InstanceOp_cleanup_migration,
+}
+
+// MigrationStageStatus records the most recent operation of a single migration stage.
+type MigrationStageStatus struct {
+	// Migration stage
+	Stage InstanceOp
+
+	// Most recent operation of @Stage, or nil if the stage has not been run yet.
+	Operation *InstanceOperation
+
+	// Number of times this stage has been re-tried using retry_migration.
+	Retries int
+}
+
+// Started returns true if @s has been run at least once.
+func (s MigrationStageStatus) Started() bool {
+	return s.Operation != nil
+}
+
+// Done returns true if @s has completed successfully.
+func (s MigrationStageStatus) Done() bool {
+	return s.Operation != nil && s.Operation.State == InstanceState_done
+}
+
+// Failed returns true if the most recent operation of @s did not succeed.
+func (s MigrationStageStatus) Failed() bool {
+	return s.Operation != nil && s.Operation.State == InstanceState_unavailable
+}
+
+// Processing returns true if @s is currently in progress.
+func (s MigrationStageStatus) Processing() bool {
+	return s.Operation != nil && s.Operation.State == InstanceState_processing
+}
+
+func (s MigrationStageStatus) String() string {
+	if s.Operation == nil {
+		return "not started"
+	} else if s.Retries > 0 {
+		return fmt.Sprintf("%s (%d retries)", s.Operation.State, s.Retries)
+	}
+	return s.Operation.State.String()
+}
+
+// MigrationStatus summarizes the migration stages of an instance, in order of MigrationStages.
+type MigrationStatus []MigrationStageStatus
+
+// MigrationStatusFromOperations computes the migration status from the instance @ops.
+// A retry_migration operation replaces the operation of the most recent preceding stage.
+func MigrationStatusFromOperations(ops []InstanceOperation) MigrationStatus {
+	var (
+		res  = make(MigrationStatus, len(MigrationStages))
+		last = -1 // index of the most recent stage seen so far
+	)
+
+	for i, stage := range MigrationStages {
+		res[i].Stage = stage
+	}
+
+	// Operations are not guaranteed to be ordered.
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Created.Time.Before(ops[j].Created.Time)
+	})
+
+	for i := range ops {
+		var op = &ops[i]
+
+		if op.Operation == InstanceOp_retry_migration {
+			if last >= 0 {
+				res[last].Operation = op
+				res[last].Retries++
+			}
+			continue
+		}
+		for j, stage := range MigrationStages {
+			if op.Operation == stage {
+				res[j].Operation = op
+				last = j
+			}
+		}
+	}
+	return res
+}
+
+// Stage returns the status of @stage.
+func (m MigrationStatus) Stage(stage InstanceOp) (res MigrationStageStatus, err error) {
+	for _, s := range m {
+		if s.Stage == stage {
+			return s, nil
+		}
+	}
+	return res, errors.Errorf("%s is not a migration stage", stage)
+}
+
+// skipped returns true if the optional stage at index @i was not run, but a later stage was.
+func (m MigrationStatus) skipped(i int) bool {
+	if m[i].Stage != InstanceOp_test_migration || m[i].Started() {
+		return false
+	}
+	for _, s := range m[i+1:] {
+		if s.Started() {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the next stage that needs to be run, or false if the migration has completed.
+// If @retry is true, the stage failed previously and needs to be re-tried via retry_migration.
+func (m MigrationStatus) Next() (stage InstanceOp, retry, ok bool) {
+	for i, s := range m {
+		if !s.Done() && !m.skipped(i) {
+			return s.Stage, s.Failed(), true
+		}
+	}
+	return stage, false, false
+}
+
+// CheckPrerequisites returns an error if @stage can not be run, given the current status @m.
+func (m MigrationStatus) CheckPrerequisites(stage InstanceOp) error {
+	if stage == InstanceOp_retry_migration {
+		if next, retry, ok := m.Next(); !ok {
+			return errors.Errorf("migration has already completed")
+		} else if !retry {
+			return errors.Errorf("nothing to retry: %s has not failed", next)
+		}
+		return nil
+	}
+
+	for _, s := range m {
+		if s.Processing() {
+			return errors.Errorf("%s is still in progress", s.Stage)
+		} else if s.Stage == stage {
+			if s.Done() {
+				return errors.Errorf("%s has already completed", stage)
+			} else if s.Failed() {
+				return errors.Errorf("%s failed previously - use %s", stage, InstanceOp_retry_migration)
+			}
+			return nil
+		} else if s.Stage == InstanceOp_test_migration && !s.Started() {
+			continue // optional stage
+		} else if !s.Done() {
+			return errors.Errorf("%s requires %s to complete first", stage, s.Stage)
+		}
+	}
+	return errors.Errorf("%s is not a migration stage", stage)
+}
+
+// GetMigrationStatus returns the status of each migration stage of @instanceId.
+func (c *Client) GetMigrationStatus(instanceId string) (MigrationStatus, error) {
+	ops, err := c.GetInstanceOperations(instanceId)
+	if err != nil {
+		return nil, err
+	}
+	return MigrationStatusFromOperations(ops), nil
+}
+
+// PrepareMigration sets up the migration infrastructure for @instanceId.
+func (c *Client) PrepareMigration(instanceId string) error {
+	return c.MigrateInstance(instanceId, InstanceOp_prepare_migration)
+}
+
+// TestMigration performs a test-failover of @instanceId.
+func (c *Client) TestMigration(instanceId string) error {
+	return c.MigrateInstance(instanceId, InstanceOp_test_migration)
+}
+
+// RunMigration performs the actual migration of @instanceId.
+func (c *Client) RunMigration(instanceId string) error {
+	return c.MigrateInstance(instanceId, InstanceOp_run_migration)
+}
+
+// RetryMigration re-tries the failed migration stage of @instanceId.
+func (c *Client) RetryMigration(instanceId string) error {
+	return c.MigrateInstance(instanceId, InstanceOp_retry_migration)
+}
+
+// CleanupMigration removes the migration infrastructure of @instanceId.
+func (c *Client) CleanupMigration(instanceId string) error {
+	return c.MigrateInstance(instanceId, InstanceOp_cleanup_migration)
+}
+
+// MigrateInstance runs the migration operation @op on @instanceId.
+func (c *Client) MigrateInstance(instanceId string, op InstanceOp) error {
+	switch op {
+	case InstanceOp_prepare_migration, InstanceOp_test_migration, InstanceOp_run_migration,
+		InstanceOp_retry_migration, InstanceOp_cleanup_migration:
+		return c.getResponse(fmt.Sprintf("/services/instances/%s/%s", instanceId, op), "PUT", nil, nil)
+	}
+	return errors.Errorf("invalid migration operation %q", op)
+}
@@ -0,0 +1,219 @@
+package clccam
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Box Archives
+ *
+ * A box archive is a gzip-compressed tar file containing a box directory, preceded by a manifest
+ * that lists the checksums of the files, so that boxes can be shipped as single file.
+ */
+
+// Name of the manifest within a box archive.
+const BoxManifestName = "manifest.json"
+
+// BoxManifest describes the contents of a box archive.
+type BoxManifest struct {
+	Box     string            `json:"box"`               // Box ID
+	Name    string            `json:"name"`              // Box name
+	Version string            `json:"version,omitempty"` // Box version (e.g. "1.2.0"), if the box is a version
+	Created time.Time         `json:"created"`           // Creation time of the archive
+	Files   []BoxManifestFile `json:"files"`
+}
+
+// BoxManifestFile is a file within a box archive.
+type BoxManifestFile struct {
+	Path   string `json:"path"` // relative to the box directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// IsBoxArchive returns true if @file is named like a box archive.
+func IsBoxArchive(file string) bool {
+	return strings.HasSuffix(file, ".tgz") || strings.HasSuffix(file, ".tar.gz")
+}
+
+// PackBoxDir writes the box directory @dir as box archive to @w.
+// Hidden files are not included.
+func PackBoxDir(dir string, w io.Writer) (*BoxManifest, error) {
+	var (
+		box      Box
+		files    = make(map[string][]byte)
+		manifest = &BoxManifest{Created: time.Now().UTC()}
+	)
+
+	// Sometimes a 'draft' directory is inserted between the directory and its contents.
+	if _, err := os.Stat(path.Join(dir, "draft", BoxFileName)); err == nil {
+		dir = path.Join(dir, "draft")
+	}
+
+	if content, err := ioutil.ReadFile(path.Join(dir, BoxFileName)); err != nil {
+		return nil, errors.Errorf("unable to read %s: %s", BoxFileName, err)
+	} else if err = yaml.Unmarshal(content, &box); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize %s", BoxFileName)
+	}
+	manifest.Box, manifest.Name = box.ID.String(), box.Name
+	if box.BoxVersion != nil {
+		manifest.Version = box.Version().String()
+	}
+
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		} else if strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if fi.IsDir() {
+			return nil
+		} else if !fi.Mode().IsRegular() {
+			return errors.Errorf("%s is not a regular file", rel)
+		}
+
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files[rel] = b
+
+		sum := sha256.Sum256(b)
+		manifest.Files = append(manifest.Files, BoxManifestFile{Path: rel, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", dir)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	mb, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		gz = gzip.NewWriter(w)
+		tw = tar.NewWriter(gz)
+	)
+
+	// @add writes file @name with content @b to the archive.
+	add := func(name string, b []byte) error {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(b)),
+			ModTime:  manifest.Created,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+
+	if err := add(BoxManifestName, mb); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", BoxManifestName)
+	}
+	for _, f := range manifest.Files {
+		if err := add(f.Path, files[f.Path]); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", f.Path)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// UnpackBoxArchive extracts the box archive @r into the directory @dir, verifying the checksums of the manifest.
+func UnpackBoxArchive(r io.Reader, dir string) (*BoxManifest, error) {
+	var (
+		manifest *BoxManifest
+		expected = make(map[string]BoxManifestFile)
+	)
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "not a box archive")
+	}
+	defer gz.Close()
+
+	for tr := tar.NewReader(gz); ; {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read box archive")
+		} else if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", hdr.Name)
+		}
+
+		if manifest == nil {
+			if hdr.Name != BoxManifestName {
+				return nil, errors.Errorf("box archive does not start with %s", BoxManifestName)
+			} else if err := json.Unmarshal(b, &manifest); err != nil {
+				return nil, errors.Wrapf(err, "failed to deserialize %s", BoxManifestName)
+			}
+			for _, f := range manifest.Files {
+				expected[f.Path] = f
+			}
+			continue
+		}
+
+		var name = path.Clean(hdr.Name)
+		f, ok := expected[name]
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, errors.Errorf("invalid path %q in box archive", hdr.Name)
+		} else if !ok {
+			return nil, errors.Errorf("%s is not listed in %s", hdr.Name, BoxManifestName)
+		} else if sum := sha256.Sum256(b); int64(len(b)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, errors.Errorf("checksum mismatch of %s", name)
+		}
+		delete(expected, name)
+
+		var dst = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		} else if err := ioutil.WriteFile(dst, b, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.Errorf("box archive is empty")
+	}
+	for name := range expected {
+		return nil, errors.Errorf("%s is missing from the box archive", name)
+	}
+	return manifest, nil
+}
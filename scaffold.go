@@ -0,0 +1,132 @@
+package clccam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+ * Box Scaffolding
+ *
+ * Generates a new box directory that can be imported as is (see LintBoxDir), to be used as starting point.
+ */
+
+// Short names of the box types, mapped to their schemas.
+var boxTypeSchemas = map[string]string{
+	"script":         ScriptBoxSchema,
+	"policy":         PolicyBoxSchema,
+	"cloudformation": CloudFormationBoxSchema,
+	"composite":      CompositeBoxSchema,
+}
+
+// BoxTypeSchema returns the schema of box type @boxType (e.g. "script").
+func BoxTypeSchema(boxType string) (string, error) {
+	if schema, ok := boxTypeSchemas[strings.ToLower(boxType)]; ok {
+		return schema, nil
+	}
+	return "", errors.Errorf("invalid box type %q (expecting script, policy, cloudformation or composite)", boxType)
+}
+
+// BoxScaffold describes a box directory to be generated.
+type BoxScaffold struct {
+	Name   string     // Box name
+	Owner  string     // Box owner
+	Schema string     // One of the BoxSchemas
+	Events []BoxEvent // Events to create stub scripts for (script boxes only)
+}
+
+// Sample File variable contents, relative to the box directory.
+var scaffoldConfigFile = path.Join(BoxFilesDir, "config", "config.txt")
+
+// Sample CloudFormation template, relative to the box directory.
+var scaffoldTemplateFile = path.Join(BoxTemplatesDir, "template.json")
+
+const scaffoldTemplate = `{
+  "AWSTemplateFormatVersion": "2010-09-09",
+  "Description": "Replace with your CloudFormation template",
+  "Resources": {}
+}
+`
+
+// Create writes the box directory described by @s to @dir, which must not already contain a box.
+func (s *BoxScaffold) Create(dir string) (*Box, error) {
+	var files = make(map[string]string) // relative path -> content
+
+	schema, err := UriFromString(s.Schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid schema %q", s.Schema)
+	}
+
+	if _, err := os.Stat(path.Join(dir, BoxFileName)); err == nil {
+		return nil, errors.Errorf("%s already contains a %s", dir, BoxFileName)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate box ID")
+	}
+
+	var box = Box{
+		ID:           id,
+		Name:         s.Name,
+		Owner:        s.Owner,
+		Visibility:   Visibility_Workspace,
+		Description:  fmt.Sprintf("%s (generated by 'box init')", s.Name),
+		Schema:       *schema,
+		Requirements: []string{},
+		Members:      []WorkSpaceMember{},
+		Variables: []BoxVariable{
+			{BasicVariable: BasicVariable{Name: "username", Type: "Text", Value: "admin"}},
+			{BasicVariable: BasicVariable{Name: "password", Type: "Password"}, Required: true},
+			{BasicVariable: BasicVariable{Name: "port", Type: "Port", Value: "8080"}},
+			{BasicVariable: BasicVariable{Name: "workers", Type: "Number", Value: "2"}},
+			{BasicVariable: BasicVariable{Name: "mode", Type: "Options", Value: "production"}, Options: "development,production"},
+			{BasicVariable: BasicVariable{Name: "config", Type: "File", Value: scaffoldConfigFile}},
+			{BasicVariable: BasicVariable{Name: "database", Type: "Box"}},
+			{BasicVariable: BasicVariable{Name: "peers", Type: "Binding"}},
+		},
+	}
+	files[scaffoldConfigFile] = "# Sample configuration file, uploaded as File variable 'config'.\n"
+
+	switch s.Schema {
+	case ScriptBoxSchema:
+		for _, evt := range s.Events {
+			files[path.Join(BoxEventsDir, evt.String())] = fmt.Sprintf("#!/bin/bash\n#\n# %s event of %s\n#\nset -e\n", evt, s.Name)
+		}
+	case PolicyBoxSchema:
+		box.Claims = []string{strings.ToLower(strings.Replace(s.Name, " ", "-", -1))}
+	case CloudFormationBoxSchema:
+		u, err := UriFromString(scaffoldTemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		box.Template = &BlobResponse{Url: *u, ContentType: "application/json"}
+		files[scaffoldTemplateFile] = scaffoldTemplate
+	}
+
+	files[ReadmeName] = fmt.Sprintf("# %s\n\nDescribe what this box does, its variables and how to deploy it.\n", s.Name)
+
+	for rel, content := range files {
+		var dst = path.Join(dir, rel)
+
+		if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+			return nil, errors.Errorf("failed to create directory: %s", err)
+		} else if err := ioutil.WriteFile(dst, []byte(content), 0644); err != nil {
+			return nil, errors.Errorf("failed to write %s: %s", rel, err)
+		}
+	}
+
+	if b, err := yaml.Marshal(box); err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize %s", BoxFileName)
+	} else if err := ioutil.WriteFile(path.Join(dir, BoxFileName), b, 0644); err != nil {
+		return nil, errors.Wrapf(err, "failed to write %s", BoxFileName)
+	}
+	return &box, nil
+}
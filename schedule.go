@@ -0,0 +1,240 @@
+package clccam
+
+import (
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+/*
+ * Power Schedules
+ *
+ * Cron-based rules that power instances off and on, e.g. to turn non-production instances off at night.
+ */
+
+// PowerSchedules is the YAML definition of a set of power schedules.
+type PowerSchedules struct {
+	// Default timezone of all schedules (e.g. "America/Chicago"); local time if empty.
+	Timezone string `json:"timezone"`
+
+	// The individual schedules.
+	Schedules []PowerSchedule `json:"schedules"`
+}
+
+// PowerSchedule powers the instances it selects off and/or on at the times given by cron expressions.
+type PowerSchedule struct {
+	// Name of the schedule, used in plans and the journal
+	Name string `json:"name"`
+
+	// Selects the instances that have all of these tags
+	Tags []string `json:"tags,omitempty"`
+
+	// Selects the instances listed by ID
+	Instances []string `json:"instances,omitempty"`
+
+	// Timezone of the cron expressions, overriding the default timezone
+	Timezone string `json:"timezone,omitempty"`
+
+	// Standard 5-field cron expressions (e.g. "0 20 * * 1-5"); either may be empty.
+	PowerOff string `json:"power_off,omitempty"`
+	PowerOn  string `json:"power_on,omitempty"`
+
+	// Parsed @PowerOff and @PowerOn
+	powerOff, powerOn cron.Schedule
+}
+
+// ScheduledAction is a power action of a schedule on a particular instance.
+type ScheduledAction struct {
+	// Time the action is due
+	Time time.Time `json:"time"`
+
+	// Name of the schedule that triggered the action
+	Schedule string `json:"schedule"`
+
+	// PlanPowerOff or PlanPowerOn
+	Action PlanActionType `json:"action"`
+
+	// Instance ID and name
+	Instance string `json:"instance"`
+	Name     string `json:"name"`
+}
+
+// LoadPowerSchedules reads and validates the power schedules in @path.
+func LoadPowerSchedules(path string) (*PowerSchedules, error) {
+	var p PowerSchedules
+
+	if content, err := ioutil.ReadFile(path); err != nil {
+		return nil, errors.Errorf("unable to read schedules: %s", err)
+	} else if err = yaml.Unmarshal(content, &p); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize schedules %s", path)
+	} else if err = p.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid schedules %s", path)
+	}
+	return &p, nil
+}
+
+// scheduleLocation returns the location of timezone @tz, or local time if @tz is empty.
+// Note that time.LoadLocation returns UTC for an empty name.
+func scheduleLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// Validate checks the consistency of @p and parses the cron expressions.
+func (p *PowerSchedules) Validate() error {
+	var seen = make(map[string]bool)
+
+	if _, err := scheduleLocation(p.Timezone); err != nil {
+		return errors.Errorf("invalid timezone %q", p.Timezone)
+	}
+
+	for i := range p.Schedules {
+		var s = &p.Schedules[i]
+
+		if s.Name == "" {
+			return errors.Errorf("schedule #%d: missing name", i+1)
+		} else if seen[s.Name] {
+			return errors.Errorf("duplicate schedule %q", s.Name)
+		} else if len(s.Tags) == 0 && len(s.Instances) == 0 {
+			return errors.Errorf("schedule %s: no tags or instances selected", s.Name)
+		} else if s.PowerOff == "" && s.PowerOn == "" {
+			return errors.Errorf("schedule %s: neither power_off nor power_on specified", s.Name)
+		}
+		seen[s.Name] = true
+
+		var tz = s.Timezone
+		if tz == "" {
+			tz = p.Timezone
+		}
+		loc, err := scheduleLocation(tz)
+		if err != nil {
+			return errors.Errorf("schedule %s: invalid timezone %q", s.Name, tz)
+		}
+
+		if s.PowerOff != "" {
+			if s.powerOff, err = parseCron(s.PowerOff, loc); err != nil {
+				return errors.Wrapf(err, "schedule %s: invalid power_off expression", s.Name)
+			}
+		}
+		if s.PowerOn != "" {
+			if s.powerOn, err = parseCron(s.PowerOn, loc); err != nil {
+				return errors.Wrapf(err, "schedule %s: invalid power_on expression", s.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// parseCron parses the standard cron expression @spec, evaluated in @loc.
+func parseCron(spec string, loc *time.Location) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, err
+	} else if s, ok := sched.(*cron.SpecSchedule); ok {
+		s.Location = loc
+	}
+	return sched, nil
+}
+
+// Selects returns true if @inst is selected by @s.
+func (s *PowerSchedule) Selects(inst *Instance) bool {
+	for _, id := range s.Instances {
+		if id == inst.ID {
+			return true
+		}
+	}
+	if len(s.Tags) == 0 {
+		return false
+	}
+	for _, tag := range s.Tags {
+		if !inst.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Next returns the time of the first action of any schedule in @p after @t (zero if none).
+func (p *PowerSchedules) Next(t time.Time) (next time.Time) {
+	for i := range p.Schedules {
+		for _, sched := range []cron.Schedule{p.Schedules[i].powerOff, p.Schedules[i].powerOn} {
+			if sched == nil {
+				continue
+			} else if n := sched.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+	}
+	return next
+}
+
+// Plan returns the actions due in the interval (@from, @to] on @instances, ordered by time.
+// Terminated instances are not considered.
+func (p *PowerSchedules) Plan(instances []Instance, from, to time.Time) (res []ScheduledAction) {
+	for i := range p.Schedules {
+		var s = &p.Schedules[i]
+
+		for _, a := range []struct {
+			sched  cron.Schedule
+			action PlanActionType
+		}{{s.powerOff, PlanPowerOff}, {s.powerOn, PlanPowerOn}} {
+			if a.sched == nil {
+				continue
+			}
+			for t := a.sched.Next(from); !t.IsZero() && !t.After(to); t = a.sched.Next(t) {
+				for j := range instances {
+					if !instances[j].IsTerminated() && s.Selects(&instances[j]) {
+						res = append(res, ScheduledAction{
+							Time:     t,
+							Schedule: s.Name,
+							Action:   a.action,
+							Instance: instances[j].ID,
+							Name:     instances[j].Name,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Time.Equal(res[j].Time) {
+			return res[i].Time.Before(res[j].Time)
+		}
+		return res[i].Instance < res[j].Instance
+	})
+	return res
+}
+
+// ApplyScheduledAction performs @a, unless the instance is in the middle of an operation, or already
+// in the desired power state. Returns a non-empty reason if the action was skipped.
+func (c *Client) ApplyScheduledAction(a ScheduledAction) (skipped string, err error) {
+	inst, err := c.GetInstance(a.Instance)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to query instance %s", a.Instance)
+	} else if inst.IsTerminated() {
+		return "instance is terminated", nil
+	} else if inst.State == InstanceState_processing {
+		return "instance is processing " + inst.Operation.Event.String(), nil
+	}
+
+	switch a.Action {
+	case PlanPowerOff:
+		if !inst.PoweredOn() {
+			return "instance is already powered off", nil
+		}
+		return "", c.ShutdownInstance(a.Instance)
+	case PlanPowerOn:
+		if inst.PoweredOn() {
+			return "instance is already powered on", nil
+		}
+		return "", c.PowerOnInstance(a.Instance)
+	}
+	return "", errors.Errorf("unsupported scheduled action %q", a.Action)
+}
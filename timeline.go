@@ -0,0 +1,266 @@
+package clccam
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+ * Instance Timeline
+ *
+ * Merges the state history, operations and activities of an instance into a single ordered view,
+ * and breaks each operation down into phases (provisioning, followed by the box events).
+ */
+
+// TimelineKind identifies the source of a TimelineEntry.
+type TimelineKind string
+
+const (
+	TimelineState     TimelineKind = "state"
+	TimelineOperation TimelineKind = "operation"
+	TimelineActivity  TimelineKind = "activity"
+)
+
+// The name of the phase that precedes the first box event of an operation.
+const PhaseProvisioning = "provisioning"
+
+// TimelineEntry is a single event on the timeline of an instance.
+type TimelineEntry struct {
+	// Source of this entry
+	Kind TimelineKind
+
+	// Start time of the entry
+	Start time.Time
+
+	// End time of the entry, zero if unknown or not applicable
+	End time.Time
+
+	// Machine the entry refers to (activities only)
+	Machine string
+
+	// Level of the activity, or state of the operation
+	Level string
+
+	// Descriptive text
+	Text string
+}
+
+// Duration returns the duration of @e, or 0 if @e has no end time.
+func (e TimelineEntry) Duration() time.Duration {
+	if e.End.IsZero() || e.End.Before(e.Start) {
+		return 0
+	}
+	return e.End.Sub(e.Start)
+}
+
+// TimelinePhase is a contiguous section of an operation on a single machine.
+type TimelinePhase struct {
+	// Operation the phase belongs to
+	Operation InstanceOp
+
+	// Start time of the operation
+	OperationStart time.Time
+
+	// Phase name: either PhaseProvisioning or a BoxEvent
+	Name string
+
+	// Box whose event script ran during the phase (empty for PhaseProvisioning)
+	Box string
+
+	// Machine the phase ran on (empty for PhaseProvisioning)
+	Machine string
+
+	// Start and end times
+	Start, End time.Time
+}
+
+// Duration returns the duration of @p.
+func (p TimelinePhase) Duration() time.Duration {
+	if p.End.Before(p.Start) {
+		return 0
+	}
+	return p.End.Sub(p.Start)
+}
+
+func (p TimelinePhase) String() string {
+	if p.Box == "" {
+		return p.Name
+	}
+	return fmt.Sprintf("%s/%s", p.Box, p.Name)
+}
+
+// Timeline is the merged, time-ordered history of an instance.
+type Timeline struct {
+	// Entries ordered by start time
+	Entries []TimelineEntry
+
+	// Phases ordered by start time
+	Phases []TimelinePhase
+}
+
+// Start returns the earliest time recorded in @t.
+func (t *Timeline) Start() (start time.Time) {
+	for _, e := range t.Entries {
+		if start.IsZero() || e.Start.Before(start) {
+			start = e.Start
+		}
+	}
+	return start
+}
+
+// End returns the latest time recorded in @t.
+func (t *Timeline) End() (end time.Time) {
+	for _, e := range t.Entries {
+		if e.End.After(end) {
+			end = e.End
+		}
+		if e.Start.After(end) {
+			end = e.Start
+		}
+	}
+	return end
+}
+
+// NewTimeline merges @srv state history, @ops and the instance @activities into a Timeline.
+// Activities that are also contained in @ops are included only once.
+func NewTimeline(srv *InstanceService, ops []InstanceOperation, activities []InstanceActivity) *Timeline {
+	var (
+		t    = new(Timeline)
+		seen = make(map[string]bool) // de-duplicates activities
+	)
+
+	addActivity := func(a InstanceActivity) {
+		var key = fmt.Sprintf("%s|%s|%s", a.Created.Time, a.Machine, a.Text)
+
+		if !seen[key] {
+			seen[key] = true
+			t.Entries = append(t.Entries, TimelineEntry{
+				Kind:    TimelineActivity,
+				Start:   a.Created.Time,
+				End:     a.Finished.Time,
+				Machine: a.Machine,
+				Level:   a.Level,
+				Text:    a.Text,
+			})
+		}
+	}
+
+	if srv != nil {
+		for _, s := range srv.StateHistory {
+			t.Entries = append(t.Entries, TimelineEntry{
+				Kind:  TimelineState,
+				Start: s.Started.Time,
+				End:   s.Completed.Time,
+				Level: s.State,
+				Text:  fmt.Sprintf("service %s", s.State),
+			})
+		}
+	}
+
+	for _, op := range ops {
+		t.Entries = append(t.Entries, TimelineEntry{
+			Kind:  TimelineOperation,
+			Start: op.Created.Time,
+			End:   op.Updated.Time,
+			Level: op.State.String(),
+			Text:  fmt.Sprintf("%s by %s", op.Operation, op.Username),
+		})
+		for _, a := range op.Activity {
+			addActivity(a)
+		}
+		t.Phases = append(t.Phases, operationPhases(op)...)
+	}
+
+	for _, a := range activities {
+		addActivity(a)
+	}
+
+	sort.SliceStable(t.Entries, func(i, j int) bool {
+		return t.Entries[i].Start.Before(t.Entries[j].Start)
+	})
+	sort.SliceStable(t.Phases, func(i, j int) bool {
+		return t.Phases[i].Start.Before(t.Phases[j].Start)
+	})
+	return t
+}
+
+// operationPhases breaks @op down into phases.
+// The provisioning phase lasts until the first box event script activity; each box event phase
+// lasts from its first to its last activity on a given machine.
+func operationPhases(op InstanceOperation) (phases []TimelinePhase) {
+	var (
+		activities = append([]InstanceActivity{}, op.Activity...)
+		current    = make(map[string]int) // machine -> index of current phase in @phases
+		opEnd      = op.Updated.Time
+		provEnd    time.Time
+	)
+
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Created.Time.Before(activities[j].Created.Time)
+	})
+
+	for _, a := range activities {
+		var end = a.Created.Time
+
+		if a.Finished.Time.After(end) {
+			end = a.Finished.Time
+		}
+		if end.After(opEnd) {
+			opEnd = end
+		}
+
+		if a.Box == "" { // Not a box event script activity
+			continue
+		} else if provEnd.IsZero() {
+			provEnd = a.Created.Time
+		}
+
+		if i, ok := current[a.Machine]; ok && phases[i].Name == a.Event.String() && phases[i].Box == a.Box {
+			if end.After(phases[i].End) {
+				phases[i].End = end
+			}
+			continue
+		}
+		current[a.Machine] = len(phases)
+		phases = append(phases, TimelinePhase{
+			Operation:      op.Operation,
+			OperationStart: op.Created.Time,
+			Name:           a.Event.String(),
+			Box:            a.Box,
+			Machine:        a.Machine,
+			Start:          a.Created.Time,
+			End:            end,
+		})
+	}
+
+	if provEnd.IsZero() {
+		provEnd = opEnd
+	}
+	return append([]TimelinePhase{{
+		Operation:      op.Operation,
+		OperationStart: op.Created.Time,
+		Name:           PhaseProvisioning,
+		Start:          op.Created.Time,
+		End:            provEnd,
+	}}, phases...)
+}
+
+// GetInstanceTimeline retrieves state history, operations and activities of @instanceId as a Timeline.
+func (c *Client) GetInstanceTimeline(instanceId string) (*Timeline, error) {
+	srv, err := c.GetInstanceService(instanceId)
+	if err != nil {
+		return nil, err
+	}
+
+	ops, err := c.GetInstanceOperations(instanceId)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := c.GetInstanceActivity(instanceId, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewTimeline(&srv, ops, activities), nil
+}
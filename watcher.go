@@ -0,0 +1,319 @@
+package clccam
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+/*
+ * Instance Watcher
+ *
+ * Periodically polls the instance list (and optionally the operations of each instance),
+ * compares successive snapshots and emits typed events describing the changes.
+ */
+
+// WatchEventType identifies the kind of change reported by a WatchEvent.
+type WatchEventType string
+
+const (
+	WatchCreated           WatchEventType = "created"
+	WatchStateChanged      WatchEventType = "state_changed"
+	WatchOperationStarted  WatchEventType = "operation_started"
+	WatchOperationFinished WatchEventType = "operation_finished"
+	WatchMachineAdded      WatchEventType = "machine_added"
+	WatchMachineRemoved    WatchEventType = "machine_removed"
+	WatchTerminated        WatchEventType = "terminated"
+
+	// An activity with non-zero exit code was recorded (only when watching operations).
+	WatchActivityFailed WatchEventType = "activity_failed"
+
+	// Polling failed; the watcher keeps going.
+	WatchError WatchEventType = "error"
+)
+
+// WatchEvent describes a single change of an instance.
+type WatchEvent struct {
+	// Kind of change
+	Type WatchEventType `json:"type"`
+
+	// Time the change was detected (or recorded, where known)
+	Time time.Time `json:"time"`
+
+	// Instance ID, name and owner
+	Instance string `json:"instance,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+
+	// Operation (for operation events, and the current operation otherwise)
+	Operation string `json:"operation,omitempty"`
+
+	// Operation ID (only when watching operations)
+	OperationID string `json:"operation_id,omitempty"`
+
+	// Previous and current state
+	OldState string `json:"old_state,omitempty"`
+	State    string `json:"state,omitempty"`
+
+	// Machine name (machine and activity events only)
+	Machine string `json:"machine,omitempty"`
+
+	// Exit code of a failed activity
+	ExitCode int64 `json:"exit_code,omitempty"`
+
+	// Descriptive text, or error message for WatchError
+	Text string `json:"text,omitempty"`
+}
+
+func (e WatchEvent) String() string {
+	var s = fmt.Sprintf("%s %s", e.Type, e.Instance)
+
+	if e.Name != "" {
+		s += fmt.Sprintf(" (%s)", e.Name)
+	}
+	if e.Text != "" {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+// Watcher polls instances and reports changes as WatchEvents.
+type Watcher struct {
+	client *Client
+
+	// Polling interval
+	Interval time.Duration
+
+	// Whether to also poll the operations of each changed or processing instance.
+	// This reports individual operations more accurately, at the expense of additional API calls.
+	Operations bool
+
+	// Whether to report all instances found by the first poll as created.
+	EmitInitial bool
+
+	// On the first poll, report operations and activities recorded after this time.
+	// Allows to resume watching without missing events. Only used when watching operations.
+	Since time.Time
+
+	// Previous snapshot, indexed by instance ID
+	instances map[string]Instance
+
+	// Operations seen so far, indexed by operation ID
+	operations map[string]InstanceOperation
+
+	// Number of activities seen so far, indexed by operation ID
+	activities map[string]int
+}
+
+// NewWatcher returns a Watcher that uses @c to poll every @interval.
+func NewWatcher(c *Client, interval time.Duration) *Watcher {
+	return &Watcher{client: c, Interval: interval}
+}
+
+// Watch polls until @ctx is cancelled, sending events to the returned channel.
+// The channel is closed when @ctx is done.
+func (w *Watcher) Watch(ctx context.Context) <-chan WatchEvent {
+	var events = make(chan WatchEvent)
+
+	go func() {
+		defer close(events)
+
+		for {
+			for _, evt := range w.Poll() {
+				select {
+				case events <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.Interval):
+			}
+		}
+	}()
+	return events
+}
+
+// Poll takes a new snapshot and returns the changes relative to the previous one.
+// The first call only establishes the baseline, unless @w.EmitInitial is set.
+func (w *Watcher) Poll() (events []WatchEvent) {
+	var (
+		now     = time.Now()
+		initial = w.instances == nil
+		current = make(map[string]Instance)
+	)
+
+	instances, err := w.client.GetInstances()
+	if err != nil {
+		return []WatchEvent{{Type: WatchError, Time: now, Text: fmt.Sprintf("failed to query instances: %s", err)}}
+	}
+
+	for _, cur := range instances {
+		current[cur.ID] = cur
+
+		prev, known := w.instances[cur.ID]
+		if !known {
+			if !initial || w.EmitInitial {
+				events = append(events, newWatchEvent(WatchCreated, now, &cur))
+			}
+		} else {
+			events = append(events, diffInstances(now, &prev, &cur, !w.Operations)...)
+		}
+
+		if w.Operations && (!known || cur.State == InstanceState_processing || !cur.Updated.Time.Equal(prev.Updated.Time)) {
+			events = append(events, w.pollOperations(now, &cur, initial && !w.EmitInitial)...)
+		}
+	}
+
+	// Instances that have disappeared from the list.
+	for id, prev := range w.instances {
+		if _, ok := current[id]; !ok && !prev.IsTerminated() {
+			events = append(events, newWatchEvent(WatchTerminated, now, &prev))
+		}
+	}
+
+	w.instances = current
+	return events
+}
+
+// pollOperations reports the operations of @inst that have started or finished since the last poll,
+// as well as failed activities. If @quiet is set, only operations updated after @w.Since are reported.
+func (w *Watcher) pollOperations(now time.Time, inst *Instance, quiet bool) (events []WatchEvent) {
+	if w.operations == nil {
+		w.operations = make(map[string]InstanceOperation)
+		w.activities = make(map[string]int)
+	}
+
+	ops, err := w.client.GetInstanceOperations(inst.ID)
+	if err != nil {
+		var evt = newWatchEvent(WatchError, now, inst)
+
+		evt.Text = fmt.Sprintf("failed to query operations: %s", err)
+		return []WatchEvent{evt}
+	}
+
+	for _, op := range ops {
+		var (
+			evt   = newWatchEvent(WatchOperationStarted, op.Created.Time, inst)
+			since = w.activities[op.ID] // activities already seen
+		)
+
+		evt.Operation = op.Operation.String()
+		evt.OperationID = op.ID
+		evt.State = op.State.String()
+
+		prev, known := w.operations[op.ID]
+		w.operations[op.ID] = op
+		w.activities[op.ID] = len(op.Activity)
+
+		if quiet {
+			if w.Since.IsZero() || !op.Updated.Time.After(w.Since) {
+				continue
+			}
+			// Resuming: treat as new, but only report what happened after @w.Since.
+			known, prev.State = op.Created.Time.Before(w.Since), InstanceState_processing
+		}
+
+		if since > len(op.Activity) {
+			since = len(op.Activity)
+		}
+		for _, a := range op.Activity[since:] {
+			if a.ExitCode != 0 && (!quiet || a.Created.Time.After(w.Since)) {
+				var act = evt
+
+				act.Type, act.Time = WatchActivityFailed, a.Created.Time
+				act.Machine, act.ExitCode = a.Machine, a.ExitCode
+				act.Text = fmt.Sprintf("%s %s failed with exit code %d: %s", a.Box, a.Event, a.ExitCode, a.Text)
+				events = append(events, act)
+			}
+		}
+
+		if !known {
+			evt.Text = fmt.Sprintf("%s started by %s", op.Operation, op.Username)
+			events = append(events, evt)
+			if op.State == InstanceState_processing {
+				continue
+			}
+		} else if prev.State != InstanceState_processing || op.State == InstanceState_processing {
+			continue
+		}
+
+		evt.Type, evt.Time = WatchOperationFinished, op.Updated.Time
+		evt.OldState = InstanceState_processing.String()
+		evt.Text = fmt.Sprintf("%s finished: %s", op.Operation, op.State)
+		events = append(events, evt)
+	}
+	return events
+}
+
+// diffInstances returns the events describing the changes between @prev and @cur.
+// @withOps: whether to derive operation events from the 'last operation' of the instance.
+func diffInstances(now time.Time, prev, cur *Instance, withOps bool) (events []WatchEvent) {
+	if cur.IsTerminated() {
+		if !prev.IsTerminated() {
+			events = append(events, newWatchEvent(WatchTerminated, now, cur))
+		}
+		return events
+	}
+
+	if withOps && (cur.Operation.Event != prev.Operation.Event || !cur.Operation.Created.Time.Equal(prev.Operation.Created.Time)) {
+		var evt = newWatchEvent(WatchOperationStarted, cur.Operation.Created.Time, cur)
+
+		evt.Text = fmt.Sprintf("%s started", cur.Operation.Event)
+		events = append(events, evt)
+	}
+
+	if cur.State != prev.State {
+		var evt = newWatchEvent(WatchStateChanged, now, cur)
+
+		evt.OldState = prev.State.String()
+		evt.Text = fmt.Sprintf("%s => %s", prev.State, cur.State)
+		events = append(events, evt)
+
+		if withOps && prev.State == InstanceState_processing {
+			evt.Type = WatchOperationFinished
+			evt.Text = fmt.Sprintf("%s finished: %s", cur.Operation.Event, cur.State)
+			events = append(events, evt)
+		}
+	}
+
+	var prevMachines, curMachines = make(map[string]bool), make(map[string]bool)
+
+	for _, m := range prev.Service.Machines {
+		prevMachines[m.Name] = true
+	}
+	for _, m := range cur.Service.Machines {
+		curMachines[m.Name] = true
+		if !prevMachines[m.Name] {
+			var evt = newWatchEvent(WatchMachineAdded, now, cur)
+
+			evt.Machine, evt.Text = m.Name, fmt.Sprintf("machine %s added", m.Name)
+			events = append(events, evt)
+		}
+	}
+	for _, m := range prev.Service.Machines {
+		if !curMachines[m.Name] {
+			var evt = newWatchEvent(WatchMachineRemoved, now, cur)
+
+			evt.Machine, evt.Text = m.Name, fmt.Sprintf("machine %s removed", m.Name)
+			events = append(events, evt)
+		}
+	}
+	return events
+}
+
+// newWatchEvent returns an event of type @t for @inst.
+func newWatchEvent(t WatchEventType, when time.Time, inst *Instance) WatchEvent {
+	return WatchEvent{
+		Type:      t,
+		Time:      when,
+		Instance:  inst.ID,
+		Name:      inst.Name,
+		Owner:     inst.Owner,
+		Operation: inst.Operation.Event.String(),
+		State:     inst.State.String(),
+	}
+}